@@ -0,0 +1,137 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+// AppendObjectOptions are the preconditions of AppendObjectWithOptions.
+// Without any of them the append happens at whatever the end of the object
+// is, as AppendObject.
+type AppendObjectOptions struct {
+	ServerSideEncryption encrypt.ServerSide // SSE-C key of the object, other encryptions are kept as they are
+
+	expectedSize int64
+	checkSize    bool
+	matchETag    string
+}
+
+// SetExpectedSize appends only if the object has size bytes, so the data
+// lands at offset size. A size of 0 also accepts a missing object, which
+// is created.
+func (o *AppendObjectOptions) SetExpectedSize(size int64) error {
+	if size < 0 {
+		return errInvalidArgument("Expected size cannot be negative.")
+	}
+	o.expectedSize, o.checkSize = size, true
+	return nil
+}
+
+// SetMatchETag appends only if the object has the given ETag.
+func (o *AppendObjectOptions) SetMatchETag(etag string) error {
+	if etag == "" {
+		return errInvalidArgument("ETag cannot be empty.")
+	}
+	o.matchETag = trimEtag(etag)
+	return nil
+}
+
+// ErrAppendPositionMismatch is returned by AppendObjectWithOptions when the
+// object does not have the expected size or ETag, nothing was appended.
+// ActualSize and ActualETag describe the object as found, 0 and empty if
+// it does not exist.
+type ErrAppendPositionMismatch struct {
+	ObjectName   string
+	ExpectedSize int64 // -1 if the size was not checked
+	ExpectedETag string
+	ActualSize   int64
+	ActualETag   string
+}
+
+func (e ErrAppendPositionMismatch) Error() string {
+	if e.ExpectedSize < 0 {
+		return fmt.Sprintf("append to %s expected ETag %s, found ETag %s with %d bytes", e.ObjectName, e.ExpectedETag, e.ActualETag, e.ActualSize)
+	}
+	return fmt.Sprintf("append to %s expected %d bytes, found %d bytes", e.ObjectName, e.ExpectedSize, e.ActualSize)
+}
+
+// AppendObjectWithOptions is AppendObject checked against the expected
+// size or ETag of opts. The object is pinned by its ETag with If-Match, so
+// a concurrent write between the check and the append, or a transport
+// level retry of an append that was already applied, fails with
+// ErrAppendPositionMismatch instead of interleaving or duplicating data.
+// A writer that knows the size it appended up to can thus append every
+// record exactly once: on a mismatch whose ActualSize is the expected size
+// plus the record length the record is already there.
+func (c *Client) AppendObjectWithOptions(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64,
+	opts AppendObjectOptions,
+) (UploadInfo, error) {
+	if objectSize >= maxPartSize {
+		return UploadInfo{}, errors.New("update file is too large")
+	}
+	if objectSize < 0 {
+		return UploadInfo{}, errors.New("update file is too small, Update can't use steaming upload")
+	}
+
+	putOpts := PutObjectOptions{ServerSideEncryption: opts.ServerSideEncryption}
+	if opts.checkSize {
+		st, err := c.appendPosition(ctx, bucketName, objectName, opts)
+		if err != nil {
+			return UploadInfo{}, err
+		}
+		if st.Size != opts.expectedSize || (opts.matchETag != "" && st.ETag != opts.matchETag) {
+			return UploadInfo{}, opts.mismatch(objectName, st)
+		}
+		if st.ETag == "" {
+			// Only a missing object has no ETag, nobody may create it first.
+			putOpts.customHeaders = http.Header{"If-None-Match": []string{"*"}}
+		} else {
+			putOpts.SetMatchETag(st.ETag)
+		}
+	} else if opts.matchETag != "" {
+		putOpts.SetMatchETag(opts.matchETag)
+	}
+
+	info, err := c.appendObject(ctx, bucketName, objectName, reader, objectSize, putOpts)
+	if err != nil && (opts.checkSize || opts.matchETag != "") && isPreconditionFailed(err) {
+		st, serr := c.appendPosition(ctx, bucketName, objectName, opts)
+		if serr != nil {
+			return UploadInfo{}, serr
+		}
+		return UploadInfo{}, opts.mismatch(objectName, st)
+	}
+	return info, err
+}
+
+// appendPosition stats the object, a missing object is returned as an
+// empty one without ETag.
+func (c *Client) appendPosition(ctx context.Context, bucketName, objectName string, opts AppendObjectOptions) (ObjectInfo, error) {
+	st, err := c.StatObject(ctx, bucketName, objectName, StatObjectOptions{ServerSideEncryption: encrypt.SSE(opts.ServerSideEncryption)})
+	if err != nil {
+		if ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, nil
+		}
+		return ObjectInfo{}, err
+	}
+	st.ETag = trimEtag(st.ETag)
+	return st, nil
+}
+
+func (o AppendObjectOptions) mismatch(objectName string, st ObjectInfo) ErrAppendPositionMismatch {
+	e := ErrAppendPositionMismatch{
+		ObjectName:   objectName,
+		ExpectedSize: -1,
+		ExpectedETag: o.matchETag,
+		ActualSize:   st.Size,
+		ActualETag:   st.ETag,
+	}
+	if o.checkSize {
+		e.ExpectedSize = o.expectedSize
+	}
+	return e
+}
@@ -0,0 +1,209 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultAppendFlushSize - buffered bytes that make an AppendWriter flush.
+const defaultAppendFlushSize = 1024 * 1024 * 4
+
+// AppendWriterOptions configures NewAppendWriter.
+type AppendWriterOptions struct {
+	FlushSize     int64         // buffered bytes that trigger a flush, default 4MiB, less than 5GiB
+	FlushInterval time.Duration // buffered data is flushed at least this often, 0 to flush only by size, Flush and Close
+	MaxRetries    int           // retries of a failed flush, as ChunkedUploadOptions.MaxRetries
+
+	// MaxObjectSize starts a new object when a flush would grow the
+	// current one beyond it, 0 never rotates. The objects are named by
+	// RotateName, the first one is objectName itself. Rotation happens
+	// between flushes, a write split by FlushSize may span two objects.
+	MaxObjectSize int64
+	RotateName    func(objectName string, n int) string // name of the n-th object from 1 on, default objectName.n
+}
+
+// AppendWriter buffers writes and appends them to an object, see
+// NewAppendWriter.
+type AppendWriter struct {
+	ctx        context.Context
+	objectName string
+	opts       AppendWriterOptions
+
+	mu      sync.Mutex // serializes writes and flushes
+	s       *chunkedSession
+	buf     []byte
+	started bool // the size of the current object is known
+	rotated int  // number of the current object, 0 for objectName
+	err     error
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAppendWriter returns a writer appending everything written to it to
+// the object, created if missing. Writes are buffered and appended when
+// FlushSize bytes are buffered, every FlushInterval and on Flush and Close.
+// Every flush is appended at the size the object is known to have with
+// AppendObjectWithOptions and failed flushes are retried, so no data is
+// duplicated; a write to the object by anybody else fails the writer with
+// ErrAppendPositionMismatch. The first failed flush, also one in the
+// background, is returned by all following calls.
+func (c *Client) NewAppendWriter(ctx context.Context, bucketName, objectName string, opts AppendWriterOptions) *AppendWriter {
+	if opts.FlushSize <= 0 || opts.FlushSize >= maxPartSize {
+		opts.FlushSize = defaultAppendFlushSize
+	}
+	if opts.RotateName == nil {
+		opts.RotateName = func(objectName string, n int) string {
+			return fmt.Sprintf("%s.%d", objectName, n)
+		}
+	}
+
+	w := &AppendWriter{
+		ctx:        ctx,
+		objectName: objectName,
+		opts:       opts,
+		s:          c.newAppendSession(bucketName, objectName, ChunkedUploadOptions{MaxRetries: opts.MaxRetries}),
+	}
+	if opts.FlushInterval > 0 {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.flushEvery(opts.FlushInterval)
+	}
+	return w
+}
+
+// Write implements io.Writer.
+func (w *AppendWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errors.New("write to closed append writer")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	var written int
+	for len(p) > 0 {
+		n := int(w.opts.FlushSize) - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		written += n
+		p = p[n:]
+		if int64(len(w.buf)) >= w.opts.FlushSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush appends the buffered data.
+func (w *AppendWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+// Close flushes the buffered data and stops the background flushes.
+func (w *AppendWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return w.err
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+// ObjectName returns the name of the object currently appended to.
+func (w *AppendWriter) ObjectName() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.s.objectName
+}
+
+func (w *AppendWriter) flushEvery(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.err == nil {
+				w.flush()
+			}
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// flush appends the buffer to the current object, rotating first if it
+// would grow too large. It must be called with the lock held, a failure
+// is kept in err.
+func (w *AppendWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	if !w.started {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if maxSize := w.opts.MaxObjectSize; maxSize > 0 {
+		for w.s.size > 0 && w.s.size+int64(len(w.buf)) > maxSize {
+			w.rotated++
+			w.s.objectName = w.opts.RotateName(w.objectName, w.rotated)
+			if err := w.open(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := w.s.writeChunk(w.ctx, w.buf, 0); err != nil {
+		w.err = err
+		return err
+	}
+	w.s.size += int64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// open reads the size of the current object.
+func (w *AppendWriter) open() error {
+	size, err := w.s.objectSize(w.ctx)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.s.size, w.started = size, true
+	return nil
+}
@@ -0,0 +1,216 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+const (
+	// defaultFollowMinPoll - wait after a poll of FollowObject found no new data.
+	defaultFollowMinPoll = 500 * time.Millisecond
+	// defaultFollowMaxPoll - longest wait between two polls of FollowObject.
+	defaultFollowMaxPoll = 30 * time.Second
+)
+
+// FollowObjectOptions configures FollowObject.
+type FollowObjectOptions struct {
+	MinPollInterval      time.Duration      // wait after a poll without new data, default 500ms
+	MaxPollInterval      time.Duration      // the wait doubles up to this while the object does not grow, default 30s
+	RestartOnReplace     bool               // read a replaced object from its start instead of failing with ErrObjectReplaced
+	ServerSideEncryption encrypt.ServerSide // SSE-C key of the object
+}
+
+// ErrObjectReplaced is returned by the reader of FollowObject when the
+// object became smaller than the offset already read, it was deleted,
+// truncated or replaced.
+type ErrObjectReplaced struct {
+	ObjectName string
+	Offset     int64
+	Size       int64 // 0 if the object no longer exists
+}
+
+func (e ErrObjectReplaced) Error() string {
+	return fmt.Sprintf("object %s was replaced, it has %d bytes while %d were read", e.ObjectName, e.Size, e.Offset)
+}
+
+// ObjectFollower reads an object as it grows, see FollowObject.
+type ObjectFollower struct {
+	c          *Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	bucketName string
+	objectName string
+	opts       FollowObjectOptions
+
+	offset int64 // next byte returned, accessed atomically
+
+	mu     sync.Mutex // held by Read
+	body   io.ReadCloser
+	wait   time.Duration
+	closed bool
+}
+
+// FollowObject returns a reader of the object from fromOffset on that
+// never ends, like tail -f: once the data is read it polls StatObject,
+// waiting from MinPollInterval up to MaxPollInterval while the object does
+// not grow or changes before its new bytes are read, and reads only the new
+// bytes with ranged GetObject requests.
+// A missing object is waited for. A fromOffset of -1 starts at the size
+// the object has at the first Read. Offset returns the position to resume
+// from with a later FollowObject.
+//
+// Reads fail once the reader is closed or the context is done, Close also
+// interrupts a blocked Read. The reader may be read again after the error
+// of a failed request. An object smaller than the offset fails the reads
+// with ErrObjectReplaced unless RestartOnReplace is set; a replacement by
+// an object at least as large is not noticed.
+func (c *Client) FollowObject(ctx context.Context, bucketName, objectName string, fromOffset int64, opts FollowObjectOptions) (*ObjectFollower, error) {
+	if fromOffset < -1 {
+		return nil, errInvalidArgument("Offset must be -1 or greater.")
+	}
+	if opts.MinPollInterval <= 0 {
+		opts.MinPollInterval = defaultFollowMinPoll
+	}
+	if opts.MaxPollInterval <= 0 {
+		opts.MaxPollInterval = defaultFollowMaxPoll
+	}
+	if opts.MaxPollInterval < opts.MinPollInterval {
+		return nil, errInvalidArgument("MaxPollInterval must not be smaller than MinPollInterval.")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &ObjectFollower{
+		c:          c,
+		ctx:        ctx,
+		cancel:     cancel,
+		bucketName: bucketName,
+		objectName: objectName,
+		opts:       opts,
+		offset:     fromOffset,
+	}, nil
+}
+
+// Offset returns the offset in the object of the next byte Read returns,
+// -1 until the first Read when following from the end of the object.
+func (f *ObjectFollower) Offset() int64 {
+	return atomic.LoadInt64(&f.offset)
+}
+
+// Read implements io.Reader, it blocks until new data is available.
+func (f *ObjectFollower) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if f.closed {
+			return 0, errors.New("read from closed object follower")
+		}
+		if err := f.ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		if f.body == nil {
+			if err := f.poll(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		n, err := f.body.Read(p)
+		atomic.AddInt64(&f.offset, int64(n))
+		if err != nil {
+			f.body.Close()
+			f.body = nil
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close implements io.Closer.
+func (f *ObjectFollower) Close() error {
+	f.cancel()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	return nil
+}
+
+// poll opens the body of the bytes past the offset or waits if there are
+// none.
+func (f *ObjectFollower) poll() error {
+	st, err := f.c.StatObject(f.ctx, f.bucketName, f.objectName, StatObjectOptions{ServerSideEncryption: f.opts.ServerSideEncryption})
+	if err != nil {
+		if ToErrorResponse(err).Code != "NoSuchKey" {
+			return err
+		}
+		st = ObjectInfo{}
+	}
+
+	offset := atomic.LoadInt64(&f.offset)
+	if offset < 0 {
+		offset = st.Size
+	}
+	if st.Size < offset {
+		if !f.opts.RestartOnReplace {
+			return ErrObjectReplaced{ObjectName: f.objectName, Offset: offset, Size: st.Size}
+		}
+		offset = 0
+	}
+	atomic.StoreInt64(&f.offset, offset)
+
+	if st.Size > offset {
+		opts := GetObjectOptions{ServerSideEncryption: f.opts.ServerSideEncryption}
+		if err = opts.SetRange(offset, st.Size-1); err != nil {
+			return err
+		}
+		// The object must still be the one just seen, it is polled
+		// again after the wait otherwise.
+		if etag := trimEtag(st.ETag); etag != "" {
+			opts.SetMatchETag(etag)
+		}
+		body, _, _, err := f.c.getObject(f.ctx, f.bucketName, f.objectName, opts)
+		if err == nil {
+			f.body, f.wait = body, 0
+			return nil
+		}
+		if !isPreconditionFailed(err) {
+			return err
+		}
+	}
+
+	if f.wait == 0 {
+		f.wait = f.opts.MinPollInterval
+	} else {
+		f.wait *= 2
+	}
+	if f.wait > f.opts.MaxPollInterval {
+		f.wait = f.opts.MaxPollInterval
+	}
+	timer := time.NewTimer(f.wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-f.ctx.Done():
+		return f.ctx.Err()
+	}
+}
@@ -294,6 +294,11 @@ type Object struct {
 
 	// Keeps track of if objectInfo has been set yet.
 	objectInfoSet bool
+
+	/* trinet */
+	// Checks the data returned by Read at the offset it was read from.
+	readHook func(offset int64, p []byte) error
+	/* trinet */
 }
 
 // doGetRequest - sends and blocks on the firstReqCh and reqCh of an object.
@@ -388,6 +393,15 @@ func (o *Object) Read(b []byte) (n int, err error) {
 		return response.Size, err
 	}
 
+	/* trinet */
+	if o.readHook != nil {
+		if herr := o.readHook(o.currOffset, b[:response.Size]); herr != nil {
+			o.prevErr = herr
+			return response.Size, herr
+		}
+	}
+	/* trinet */
+
 	// Bytes read.
 	bytesRead := int64(response.Size)
 
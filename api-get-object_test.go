@@ -20,10 +20,13 @@ package ossClient
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGetObjectReturnSuccess(t *testing.T) {
@@ -146,3 +149,107 @@ func TestGetObjectReturnErrorIfServerSendsMore(t *testing.T) {
 		t.Fatalf("Expected %v, got %v", io.ErrUnexpectedEOF, err)
 	}
 }
+
+// 测试跟随读取追加的对象
+func TestFollowObject(t *testing.T) {
+	s, srv := newPartialUpdateServer("12345")
+	defer srv.Close()
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := func(f func()) {
+		s.mu.Lock()
+		f()
+		s.etag++
+		s.mu.Unlock()
+	}
+	opts := FollowObjectOptions{MinPollInterval: time.Millisecond, MaxPollInterval: 10 * time.Millisecond}
+
+	// 从检查点开始读取，之后只读取新追加的数据
+	f, err := c.FollowObject(context.Background(), "bucket", "object", 2, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := io.ReadAtLeast(f, buf, 3)
+	if err != nil || string(buf[:n]) != "345" {
+		t.Fatal("follow read error", string(buf[:n]), err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		update(func() { s.data = append(s.data, "ab"...) })
+	}()
+	n, err = io.ReadAtLeast(f, buf, 2)
+	if err != nil || string(buf[:n]) != "ab" || f.Offset() != 7 {
+		t.Fatal("follow append error", string(buf[:n]), f.Offset(), err)
+	}
+
+	// 对象变小时返回错误
+	update(func() { s.data = []byte("x") })
+	var replaced ErrObjectReplaced
+	if _, err = f.Read(buf); !errors.As(err, &replaced) || replaced.Offset != 7 || replaced.Size != 1 {
+		t.Fatal("expected a replaced object", err)
+	}
+	f.Close()
+
+	// 从对象末尾开始，对象被替换后从头读取
+	opts.RestartOnReplace = true
+	f, err = c.FollowObject(context.Background(), "bucket", "object", -1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		update(func() { s.data = append(s.data, "yz"...) })
+		time.Sleep(20 * time.Millisecond)
+		update(func() { s.data = []byte("n") })
+	}()
+	n, err = io.ReadAtLeast(f, buf, 2)
+	if err != nil || string(buf[:n]) != "yz" {
+		t.Fatal("follow from end error", string(buf[:n]), err)
+	}
+	n, err = io.ReadAtLeast(f, buf, 1)
+	if err != nil || string(buf[:n]) != "n" || f.Offset() != 1 {
+		t.Fatal("restart on replace error", string(buf[:n]), f.Offset(), err)
+	}
+
+	// 关闭时阻塞的读取返回
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		f.Close()
+	}()
+	if _, err = f.Read(buf); err == nil {
+		t.Fatal("expected an error after close")
+	}
+
+	// 对象在HEAD与GET之间一直变化时按轮询间隔重试
+	var heads int64
+	srv412 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt64(&heads, 1)
+			w.Header().Set("ETag", "\"etag\"")
+			w.Header().Set("Content-Length", "5")
+			w.Header().Set("Last-Modified", time.Unix(1700000000, 0).UTC().Format(http.TimeFormat))
+			return
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+	}))
+	defer srv412.Close()
+	c, err = New(srv412.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	f, err = c.FollowObject(ctx, "bucket", "object", 0, FollowObjectOptions{MinPollInterval: 20 * time.Millisecond, MaxPollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Read(buf); err != context.DeadlineExceeded {
+		t.Fatal("expected the deadline", err)
+	}
+	if n := atomic.LoadInt64(&heads); n > 6 {
+		t.Fatal("polled without waiting", n)
+	}
+}
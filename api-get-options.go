@@ -201,3 +201,22 @@ func (o *GetObjectOptions) toQueryValues() url.Values {
 
 	return urlValues
 }
+
+/* trinet */
+
+// clone returns a copy of the options whose headers and query parameters
+// can be changed without affecting o.
+func (o GetObjectOptions) clone() GetObjectOptions {
+	c := o
+	c.headers = make(map[string]string, len(o.headers))
+	for k, v := range o.headers {
+		c.headers[k] = v
+	}
+	c.reqParams = make(url.Values, len(o.reqParams))
+	for k, v := range o.reqParams {
+		c.reqParams[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+/* trinet */
@@ -0,0 +1,136 @@
+package ossClient
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AbortStaleUploadsOptions configures AbortStaleUploadsWithOptions.
+type AbortStaleUploadsOptions struct {
+	OlderThan  time.Duration // uploads initiated earlier than this are stale
+	DryRun     bool          // only report the stale uploads
+	NumThreads int           // uploads inspected and aborted in parallel, default 4
+}
+
+// StaleUpload is a multipart upload found by AbortStaleUploads.
+type StaleUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+	PartSizes map[int]int64 // size of every uploaded part by part number
+	Size      int64         // total size of the uploaded parts
+	Aborted   bool
+	Err       error // listing the parts or aborting the upload failed
+}
+
+// StaleUploadsReport is the result of AbortStaleUploads.
+type StaleUploadsReport struct {
+	Scanned int           // in-progress uploads under the prefix
+	Stale   []StaleUpload // sorted by key and upload ID
+	Aborted int
+	Size    int64 // total size of the parts of the aborted uploads, of all stale uploads on a dry run
+}
+
+// AbortStaleUploads aborts the multipart uploads below prefix initiated
+// more than olderThan ago, such as uploads of NewUploadID never completed
+// or left behind by failed streams. With dryRun nothing is aborted.
+func (c *Client) AbortStaleUploads(ctx context.Context, bucketName, prefix string, olderThan time.Duration, dryRun bool) (StaleUploadsReport, error) {
+	return c.AbortStaleUploadsWithOptions(ctx, bucketName, prefix, AbortStaleUploadsOptions{
+		OlderThan: olderThan,
+		DryRun:    dryRun,
+	})
+}
+
+// AbortStaleUploadsWithOptions is AbortStaleUploads with a limit on the
+// uploads handled in parallel. The parts of every stale upload are listed
+// for the report. A failure to list or abort an upload is recorded in its
+// entry and does not stop the others, the returned error is set when the
+// uploads can not be listed, the report then covers the uploads seen so far.
+func (c *Client) AbortStaleUploadsWithOptions(ctx context.Context, bucketName, prefix string, opts AbortStaleUploadsOptions) (StaleUploadsReport, error) {
+	numThreads := opts.NumThreads
+	if numThreads <= 0 {
+		numThreads = totalWorkers
+	}
+	cutoff := time.Now().Add(-opts.OlderThan)
+
+	var (
+		report StaleUploadsReport
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	uploadCh := make(chan ObjectMultipartInfo)
+	for i := 0; i < numThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for upload := range uploadCh {
+				stale := c.abortStaleUpload(ctx, bucketName, upload, opts.DryRun)
+
+				mu.Lock()
+				report.Stale = append(report.Stale, stale)
+				if stale.Aborted {
+					report.Aborted++
+				}
+				if stale.Aborted || opts.DryRun {
+					report.Size += stale.Size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	for upload := range c.listIncompleteUploads(ctx, bucketName, prefix, true) {
+		if upload.Err != nil {
+			err = upload.Err
+			break
+		}
+		report.Scanned++
+		if upload.Initiated.After(cutoff) {
+			continue
+		}
+		uploadCh <- upload
+	}
+	close(uploadCh)
+	wg.Wait()
+
+	sort.Slice(report.Stale, func(i, j int) bool {
+		if report.Stale[i].Key != report.Stale[j].Key {
+			return report.Stale[i].Key < report.Stale[j].Key
+		}
+		return report.Stale[i].UploadID < report.Stale[j].UploadID
+	})
+	return report, err
+}
+
+// abortStaleUpload lists the parts of upload and aborts it unless dryRun.
+func (c *Client) abortStaleUpload(ctx context.Context, bucketName string, upload ObjectMultipartInfo, dryRun bool) StaleUpload {
+	stale := StaleUpload{
+		Key:       upload.Key,
+		UploadID:  upload.UploadID,
+		Initiated: upload.Initiated,
+	}
+
+	parts, err := c.listObjectParts(ctx, bucketName, upload.Key, upload.UploadID)
+	if err != nil {
+		stale.Err = err
+		return stale
+	}
+	stale.PartSizes = make(map[int]int64, len(parts))
+	for number, part := range parts {
+		stale.PartSizes[number] = part.Size
+		stale.Size += part.Size
+	}
+	if dryRun {
+		return stale
+	}
+
+	if err = c.abortMultipartUpload(ctx, bucketName, upload.Key, upload.UploadID); err != nil {
+		stale.Err = err
+		return stale
+	}
+	stale.Aborted = true
+	return stale
+}
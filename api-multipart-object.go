@@ -16,13 +16,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/trinet2005/oss-go-sdk/pkg/s3utils"
-	"hash"
-	"hash/crc32"
 	"io"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
+	"sync"
 )
 
 type MultipartUploader struct {
@@ -32,21 +31,108 @@ type MultipartUploader struct {
 	c          *Client
 	opts       *PutObjectOptions
 	partsInfo  map[int]ObjectPart
-	buf        []byte
-	// Create checksums
+	// Part buffers, UploadPart may be called from several goroutines. They
+	// grow with the data of the part up to PartSize.
+	bufPool sync.Pool
+	// opts.Progress, read by one part upload at a time
+	progress io.Reader
+	// Create checksums of the type chosen by opts.AutoChecksum
 	// CRC32C is ~50% faster on AMD64 @ 30GB/s
-	crcBytes  map[int][]byte
-	crc       hash.Hash32
-	eof       bool // The sequential upload has been completed, now can UpdatePart or CompleteMultipartUpload
+	crcBytes map[int][]byte
+
+	mu        sync.Mutex // guards partsInfo, crcBytes, eof and completed
+	eof       bool       // The sequential upload has been completed, now can UpdatePart or CompleteMultipartUpload
 	completed bool
 }
 
+// newMultipartUploader returns the uploader of uploadID, opts.PartSize
+// must be valid.
+func (c *Client) newMultipartUploader(bucketName, objectName, uploadID string, opts *PutObjectOptions, partsInfo map[int]ObjectPart) *MultipartUploader {
+	m := &MultipartUploader{
+		BucketName: bucketName,
+		ObjectName: objectName,
+		UploadID:   uploadID,
+		c:          c,
+		opts:       opts,
+		partsInfo:  partsInfo,
+		crcBytes:   make(map[int][]byte),
+	}
+	m.bufPool.New = func() interface{} {
+		return new([]byte)
+	}
+	if opts.Progress != nil {
+		m.progress = &lockedReader{r: opts.Progress}
+	}
+	return m
+}
+
+// partBufferMinSize - capacity a part buffer starts with.
+const partBufferMinSize = 1024 * 1024
+
+// growPartBuffer returns buf with room for n more bytes, the capacity is
+// doubled as needed but never beyond limit, len(buf)+n must not exceed it.
+func growPartBuffer(buf []byte, n, limit int) []byte {
+	need := len(buf) + n
+	if need <= cap(buf) {
+		return buf
+	}
+	size := 2 * cap(buf)
+	if size < partBufferMinSize {
+		size = partBufferMinSize
+	}
+	for size < need {
+		size *= 2
+	}
+	if size > limit {
+		size = limit
+	}
+	grown := make([]byte, len(buf), size)
+	copy(grown, buf)
+	return grown
+}
+
+// readPart reads up to size bytes from r into *bufp, growing it with the
+// data read, with the errors of readFull.
+func readPart(r io.Reader, bufp *[]byte, size int) (int, error) {
+	buf := (*bufp)[:0]
+	var err error
+	for len(buf) < size && err == nil {
+		buf = growPartBuffer(buf, 1, size)
+		var n int
+		n, err = r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+	}
+	*bufp = buf
+	switch {
+	case err == io.EOF && len(buf) > 0:
+		return len(buf), io.ErrUnexpectedEOF
+	case err != nil:
+		return len(buf), err
+	}
+	return len(buf), nil
+}
+
+// lockedReader serializes the reads of r.
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(p)
+}
+
 // getUploadID - fetch upload id if already present for an object name
 // or initiate a new request to fetch a new upload id.
 func (c *Client) NewUploadID(ctx context.Context, bucketName, objectName string, opts *PutObjectOptions) (*MultipartUploader, error) {
 	if opts.DisableMultipart {
 		return nil, errors.New("multipart disabled")
 	}
+	if err := opts.validateChecksum(); err != nil {
+		return nil, err
+	}
 
 	var objectSize int64 = -1
 	//if objectSize == 0 {
@@ -56,16 +142,17 @@ func (c *Client) NewUploadID(ctx context.Context, bucketName, objectName string,
 	//	objectSize = -1
 	//}
 
-	_, _, _, err := OptimalPartInfo(objectSize, opts.PartSize)
+	_, partSize, _, err := OptimalPartInfo(objectSize, opts.PartSize)
 	if err != nil {
 		return nil, err
 	}
+	opts.PartSize = uint64(partSize)
 
 	if !opts.SendContentMd5 {
 		if opts.UserMetadata == nil {
 			opts.UserMetadata = make(map[string]string, 1)
 		}
-		opts.UserMetadata["X-Amz-Checksum-Algorithm"] = "CRC32C"
+		opts.UserMetadata["X-Amz-Checksum-Algorithm"] = opts.checksumType().String()
 	}
 
 	// Input validation.
@@ -84,21 +171,54 @@ func (c *Client) NewUploadID(ctx context.Context, bucketName, objectName string,
 
 	delete(opts.UserMetadata, "X-Amz-Checksum-Algorithm")
 
-	return &MultipartUploader{
-		BucketName: bucketName,
-		ObjectName: objectName,
-		UploadID:   initMultipartUploadResult.UploadID,
-		c:          c,
-		opts:       opts,
-		partsInfo:  make(map[int]ObjectPart),    // Initialize parts uploaded map
-		buf:        make([]byte, opts.PartSize), // Create a buffer
-		crcBytes:   make(map[int][]byte),
-		crc:        crc32.New(crc32.MakeTable(crc32.Castagnoli)),
-	}, nil
+	// Initialize parts uploaded map
+	return c.newMultipartUploader(bucketName, objectName, initMultipartUploadResult.UploadID, opts, make(map[int]ObjectPart)), nil
+}
+
+// checkPartNumber - part numbers may be sparse and uploaded in any order,
+// but must lie between 1 and 10000.
+func checkPartNumber(partNumber int) error {
+	if partNumber < 1 || partNumber > maxPartsCount {
+		return errInvalidArgument(fmt.Sprintf("Part number %d is out of the range 1 to %d.", partNumber, maxPartsCount))
+	}
+	return nil
+}
+
+// lastPartNumber - highest part number uploaded so far, m.mu must be held.
+func (m *MultipartUploader) lastPartNumber() int {
+	last := 0
+	for number := range m.partsInfo {
+		if number > last {
+			last = number
+		}
+	}
+	return last
+}
+
+// MissingParts - part numbers below the highest uploaded part which were
+// not uploaded. The server completes an upload with gaps in its part
+// numbers, callers filling the parts in from several workers should check
+// that nothing is missing before CompleteMultipartUpload.
+func (m *MultipartUploader) MissingParts() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var missing []int
+	for i := 1; i < m.lastPartNumber(); i++ {
+		if _, ok := m.partsInfo[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
 }
 
 func (m *MultipartUploader) uploadPart(ctx context.Context, buf []byte, length, partNumber int) error {
+	if err := checkPartNumber(partNumber); err != nil {
+		return err
+	}
+
 	var md5Base64 string
+	var cSum []byte
 	customHeader := make(http.Header)
 	if m.opts.SendContentMd5 {
 		// Calculate md5sum.
@@ -107,16 +227,15 @@ func (m *MultipartUploader) uploadPart(ctx context.Context, buf []byte, length,
 		md5Base64 = base64.StdEncoding.EncodeToString(hash.Sum(nil))
 		hash.Close()
 	} else {
-		m.crc.Reset()
-		m.crc.Write(buf[:length])
-		cSum := m.crc.Sum(nil)
-		customHeader.Set("x-amz-checksum-crc32c", base64.StdEncoding.EncodeToString(cSum))
-		m.crcBytes[partNumber] = cSum
+		crc := m.opts.checksumType().Hasher()
+		crc.Write(buf[:length])
+		cSum = crc.Sum(nil)
+		customHeader.Set(m.opts.checksumType().Key(), base64.StdEncoding.EncodeToString(cSum))
 	}
 
 	// Update progress reader appropriately to the latest offset
 	// as we read from the source.
-	rd := newHook(bytes.NewReader(buf[:length]), m.opts.Progress)
+	rd := newHook(bytes.NewReader(buf[:length]), m.progress)
 
 	// Proceed to upload the part.
 	p := uploadPartParams{bucketName: m.BucketName, objectName: m.ObjectName, uploadID: m.UploadID,
@@ -130,18 +249,32 @@ func (m *MultipartUploader) uploadPart(ctx context.Context, buf []byte, length,
 	}
 
 	// Save successfully uploaded part metadata.
+	m.mu.Lock()
 	m.partsInfo[partNumber] = objPart
+	if cSum != nil {
+		m.crcBytes[partNumber] = cSum
+	}
+	m.mu.Unlock()
 
 	return nil
 }
 
-// UploadPart - Uploads a part in a multipart upload.
+// UploadPart - Uploads a part in a multipart upload. It is safe to call
+// UploadPart for different parts from several goroutines, each call reads
+// the part into a buffer of its own which only takes the memory of the
+// data read, up to PartSize. Progress is read by one upload at a time.
 func (m *MultipartUploader) UploadPart(ctx context.Context, data io.Reader, partNumber int) error {
-	length, rerr := readFull(data, m.buf)
+	bufp := m.bufPool.Get().(*[]byte)
+	defer m.bufPool.Put(bufp)
+
+	length, rerr := readPart(data, bufp, int(m.opts.PartSize))
+	buf := *bufp
 	// For unknown size, Read EOF we break away.
 	// We do not have to upload till totalPartsCount.
 	if rerr == io.EOF {
+		m.mu.Lock()
 		m.eof = true
+		m.mu.Unlock()
 		return io.EOF
 	}
 
@@ -149,24 +282,27 @@ func (m *MultipartUploader) UploadPart(ctx context.Context, data io.Reader, part
 		return rerr
 	}
 
-	return m.uploadPart(ctx, m.buf, length, partNumber)
+	return m.uploadPart(ctx, buf, length, partNumber)
 }
 
-// UpdatePart - Update the uploaded part.
+// UpdatePart - Update the uploaded part, or upload a part missing so far.
+// Only a part behind all uploaded parts may be smaller than 5MiB.
 func (m *MultipartUploader) UpdatePart(ctx context.Context, data io.Reader, partNumber int, configuredPartSize int) error {
-	if m.completed {
+	m.mu.Lock()
+	completed, last := m.completed, m.lastPartNumber()
+	m.mu.Unlock()
+	if completed {
 		return errors.New("upload is completed")
 	}
+	if err := checkPartNumber(partNumber); err != nil {
+		return err
+	}
 
-	if partNumber < len(m.partsInfo) {
-		if configuredPartSize < absMinPartSize {
-			return errInvalidArgument("Input part size is smaller than allowed minimum of 5MiB.")
-		}
-		if configuredPartSize > maxPartSize {
-			return errInvalidArgument("Input part size is bigger than allowed maximum of 5GiB.")
-		}
-	} else if partNumber > len(m.partsInfo) {
-		return errors.New("partNumber is illegal")
+	if partNumber < last && configuredPartSize < absMinPartSize {
+		return errInvalidArgument("Input part size is smaller than allowed minimum of 5MiB.")
+	}
+	if configuredPartSize > maxPartSize {
+		return errInvalidArgument("Input part size is bigger than allowed maximum of 5GiB.")
 	}
 
 	buf := make([]byte, configuredPartSize)
@@ -187,11 +323,15 @@ func (m *MultipartUploader) GetPart(ctx context.Context, partNumber int) (io.Rea
 }
 
 func (m *MultipartUploader) getPart(ctx context.Context, partNumber int, opts GetObjectOptions) (io.ReadCloser, ObjectInfo, error) {
-	if m.completed {
+	m.mu.Lock()
+	completed := m.completed
+	_, uploaded := m.partsInfo[partNumber]
+	m.mu.Unlock()
+	if completed {
 		return nil, ObjectInfo{}, errors.New("upload is completed")
 	}
 
-	if partNumber > len(m.partsInfo) {
+	if !uploaded {
 		return nil, ObjectInfo{}, errors.New("partNumber is illegal")
 	}
 	urlValues := make(url.Values)
@@ -226,6 +366,9 @@ func (m *MultipartUploader) getPart(ctx context.Context, partNumber int, opts Ge
 
 // CompleteMultipartUpload - Completes a multipart upload by assembling previously uploaded parts.
 func (m *MultipartUploader) CompleteMultipartUpload(ctx context.Context) (UploadInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if !m.eof {
 		return UploadInfo{}, errors.New("UploadPart doesn't end")
 	}
@@ -237,12 +380,9 @@ func (m *MultipartUploader) CompleteMultipartUpload(ctx context.Context) (Upload
 	// Complete multipart upload.
 	var complete completeMultipartUpload
 	// Loop over total uploaded parts to save them in
-	// Parts array before completing the multipart request.
-	for i := 1; i <= len(m.partsInfo); i++ {
-		part, ok := m.partsInfo[i]
-		if !ok {
-			return UploadInfo{}, errInvalidArgument(fmt.Sprintf("Missing part number %d", i))
-		}
+	// Parts array before completing the multipart request,
+	// part numbers may have gaps.
+	for _, part := range m.partsInfo {
 		complete.Parts = append(complete.Parts, CompletePart{
 			ETag:           part.ETag,
 			PartNumber:     part.PartNumber,
@@ -261,14 +401,13 @@ func (m *MultipartUploader) CompleteMultipartUpload(ctx context.Context) (Upload
 		MergeMultipart:       m.opts.MergeMultipart,
 	}
 	if len(m.crcBytes) > 0 {
-		// Add hash of hashes.
-		m.crc.Reset()
-		var crcBytes []byte
-		for i := 1; i <= len(m.crcBytes); i++ {
-			crcBytes = append(crcBytes, m.crcBytes[i]...)
+		// Add hash of hashes, in part number order whatever order
+		// the parts were uploaded in.
+		crc := m.opts.checksumType().Hasher()
+		for _, part := range complete.Parts {
+			crc.Write(m.crcBytes[part.PartNumber])
 		}
-		m.crc.Write(crcBytes)
-		opts.UserMetadata = map[string]string{"X-Amz-Checksum-Crc32c": base64.StdEncoding.EncodeToString(m.crc.Sum(nil))}
+		opts.UserMetadata = map[string]string{m.opts.checksumType().KeyCapitalized(): base64.StdEncoding.EncodeToString(crc.Sum(nil))}
 	}
 
 	// Input validation.
@@ -347,7 +486,7 @@ func (m *MultipartUploader) CompleteMultipartUpload(ctx context.Context) (Upload
 		totalUploadedSize += partInfo.Size
 	}
 
-	return UploadInfo{
+	info := UploadInfo{
 		Bucket:           completeMultipartUploadResult.Bucket,
 		Key:              completeMultipartUploadResult.Key,
 		ETag:             trimEtag(completeMultipartUploadResult.ETag),
@@ -361,7 +500,9 @@ func (m *MultipartUploader) CompleteMultipartUpload(ctx context.Context) (Upload
 		ChecksumSHA1:   completeMultipartUploadResult.ChecksumSHA1,
 		ChecksumCRC32:  completeMultipartUploadResult.ChecksumCRC32,
 		ChecksumCRC32C: completeMultipartUploadResult.ChecksumCRC32C,
-	}, nil
+	}
+	info.setChecksums(opts.UserMetadata)
+	return info, nil
 }
 
 // AbortMultipartUpload aborts a multipart upload for the given
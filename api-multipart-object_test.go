@@ -2,12 +2,19 @@ package ossClient
 
 import (
 	"context"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	uuid2 "github.com/google/uuid"
 	"github.com/trinet2005/oss-go-sdk/pkg/credentials"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type TestMultipart struct {
@@ -318,3 +325,455 @@ func TestClient_MultipartUploadPreferredEnginePool(t *testing.T) {
 	}
 
 }
+
+// 测试分段上传状态的保存与恢复, 恢复时校验已记录的CRC32C
+func TestClient_ResumeUploadFromState(t *testing.T) {
+	parts := []string{"part1", "part2"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result ListObjectPartsResult
+		for i, data := range parts {
+			result.ObjectParts = append(result.ObjectParts, ObjectPart{
+				PartNumber:     i + 1,
+				ETag:           fmt.Sprintf("\"etag%d\"", i+1),
+				Size:           int64(len(data)),
+				ChecksumCRC32C: ChecksumCRC32C.ChecksumBytes([]byte(data)).Encoded(),
+			})
+		}
+		xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"ListPartsResult"`
+			ListObjectPartsResult
+		}{ListObjectPartsResult: result})
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := c.ResumeUpload(context.Background(), "bucket", "object", "upload", &PutObjectOptions{PartSize: absMinPartSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NextPartNumber() != 3 || len(m.crcBytes) != 2 {
+		t.Fatal("resumed upload error", m.NextPartNumber())
+	}
+
+	state, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = c.ResumeUploadFromState(context.Background(), state, &PutObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.opts.PartSize != absMinPartSize || m.NextPartNumber() != 3 {
+		t.Fatal("resumed state error", m.opts.PartSize)
+	}
+
+	// 多个或未知的校验类型不会被替换为CRC32C
+	for _, checksum := range []ChecksumType{checksumLast << 1, ChecksumCRC32 | ChecksumSHA1} {
+		if _, err = c.ResumeUpload(context.Background(), "bucket", "object", "upload", &PutObjectOptions{AutoChecksum: checksum}); ToErrorResponse(err).Code != "InvalidArgument" {
+			t.Fatal("expected an unsupported checksum on resume", checksum, err)
+		}
+		if _, err = c.NewUploadID(context.Background(), "bucket", "object", &PutObjectOptions{AutoChecksum: checksum}); ToErrorResponse(err).Code != "InvalidArgument" {
+			t.Fatal("expected an unsupported checksum on a new upload", checksum, err)
+		}
+		_, err = c.PutObject(context.Background(), "bucket", "object", strings.NewReader("data"), 4, PutObjectOptions{AutoChecksum: checksum})
+		if ToErrorResponse(err).Code != "InvalidArgument" {
+			t.Fatal("expected an unsupported checksum on put", checksum, err)
+		}
+	}
+
+	// 服务端的CRC32C与记录不一致时恢复失败
+	parts[1] = "changed"
+	if _, err = c.ResumeUploadFromState(context.Background(), state, &PutObjectOptions{}); err == nil {
+		t.Fatal("expected a part mismatch")
+	}
+}
+
+func TestClient_MultipartWriter(t *testing.T) {
+	var mu sync.Mutex
+	parts := make(map[string][]byte)
+	var complete string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"InitiateMultipartUploadResult"`
+				initiateMultipartUploadResult
+			}{initiateMultipartUploadResult: initiateMultipartUploadResult{Bucket: "bucket", Key: "object", UploadID: "upload"}})
+		case r.Method == http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			if ChecksumCRC32C.ChecksumBytes(data).Encoded() != r.Header.Get("x-amz-checksum-crc32c") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			parts[r.URL.Query().Get("partNumber")] = data
+			mu.Unlock()
+			w.Header().Set("ETag", "\"etag\"")
+		case r.Method == http.MethodPost:
+			complete = r.Header.Get("X-Amz-Checksum-Crc32c")
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+				completeMultipartUploadResult
+			}{completeMultipartUploadResult: completeMultipartUploadResult{Bucket: "bucket", Key: "object", ETag: "etag-3"}})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.NewUploadID(context.Background(), "bucket", "object", &PutObjectOptions{PartSize: absMinPartSize, NumThreads: 3, DisableContentSha256: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 写入两个半分片，并发上传三个分片
+	data := []byte(strings.Repeat("0123456789", absMinPartSize/4))
+	w := m.Writer(context.Background())
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err = w.Write(data[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 || m.NextPartNumber() != 4 {
+		t.Fatal("uploaded parts error", len(parts))
+	}
+
+	info, err := m.CompleteMultipartUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatal("uploaded size error", info.Size)
+	}
+
+	// 完成时的CRC32C为按分片号排列的分片CRC32C的CRC32C
+	var crcs []byte
+	for i := 1; i <= 3; i++ {
+		crcs = append(crcs, ChecksumCRC32C.ChecksumBytes(parts[strconv.Itoa(i)]).Raw()...)
+	}
+	if expected := ChecksumCRC32C.ChecksumBytes(crcs).Encoded(); complete != expected {
+		t.Fatal("hash of hashes error", complete, expected)
+	}
+}
+
+func TestClient_MultipartSparseParts(t *testing.T) {
+	var mu sync.Mutex
+	var completed completeMultipartUpload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"InitiateMultipartUploadResult"`
+				initiateMultipartUploadResult
+			}{initiateMultipartUploadResult: initiateMultipartUploadResult{Bucket: "bucket", Key: "object", UploadID: "upload"}})
+		case r.Method == http.MethodPut:
+			io.Copy(io.Discard, r.Body)
+			w.Header().Set("ETag", "\"etag"+r.URL.Query().Get("partNumber")+"\"")
+		case r.Method == http.MethodPost:
+			mu.Lock()
+			xml.NewDecoder(r.Body).Decode(&completed)
+			mu.Unlock()
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+				completeMultipartUploadResult
+			}{completeMultipartUploadResult: completeMultipartUploadResult{Bucket: "bucket", Key: "object", ETag: "etag-3"}})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.NewUploadID(context.Background(), "bucket", "object", &PutObjectOptions{PartSize: absMinPartSize, DisableContentSha256: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不同协程乱序上传分片9、5、1
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for _, n := range []int{9, 5, 1} {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			errs <- m.UploadPart(context.Background(), strings.NewReader(strings.Repeat("a", absMinPartSize)), n)
+		}(n)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = m.UploadPart(context.Background(), strings.NewReader("a"), maxPartsCount+1); err == nil {
+		t.Fatal("expected an invalid part number")
+	}
+	if missing := fmt.Sprint(m.MissingParts()); missing != "[2 3 4 6 7 8]" {
+		t.Fatal("missing parts error", missing)
+	}
+
+	// 填补分片2，分片9之前的分片不能小于5MiB
+	if err = m.UpdatePart(context.Background(), strings.NewReader("short"), 2, 5); err == nil {
+		t.Fatal("expected a too small part")
+	}
+	if err = m.UpdatePart(context.Background(), strings.NewReader(strings.Repeat("b", absMinPartSize)), 2, absMinPartSize); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.UploadPart(context.Background(), strings.NewReader(""), 10); err != io.EOF {
+		t.Fatal(err)
+	}
+
+	if _, err = m.CompleteMultipartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int
+	for _, part := range completed.Parts {
+		numbers = append(numbers, part.PartNumber)
+	}
+	if fmt.Sprint(numbers) != "[1 2 5 9]" {
+		t.Fatal("completed parts error", numbers)
+	}
+}
+
+func TestClient_MultipartUploadChecksum(t *testing.T) {
+	var mu sync.Mutex
+	var algorithm, complete string
+	parts := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			algorithm = r.Header.Get("X-Amz-Checksum-Algorithm")
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"InitiateMultipartUploadResult"`
+				initiateMultipartUploadResult
+			}{initiateMultipartUploadResult: initiateMultipartUploadResult{Bucket: "bucket", Key: "object", UploadID: "upload"}})
+		case r.Method == http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			checksumType := parseMergeChecksumType(algorithm)
+			if checksumType.ChecksumBytes(data).Encoded() != r.Header.Get(checksumType.Key()) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			parts[r.URL.Query().Get("partNumber")] = data
+			w.Header().Set("ETag", "\"etag\"")
+		case r.Method == http.MethodPost:
+			complete = r.Header.Get(parseMergeChecksumType(algorithm).Key())
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+				completeMultipartUploadResult
+			}{completeMultipartUploadResult: completeMultipartUploadResult{Bucket: "bucket", Key: "object", ETag: "etag-2"}})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := strings.Repeat("0123456789", absMinPartSize/8)
+	uploads := map[string]func(opts PutObjectOptions) (UploadInfo, error){
+		"uploader": func(opts PutObjectOptions) (UploadInfo, error) {
+			m, err := c.NewUploadID(context.Background(), "bucket", "object", &opts)
+			if err != nil {
+				return UploadInfo{}, err
+			}
+			w := m.Writer(context.Background())
+			if _, err = io.WriteString(w, data); err != nil {
+				return UploadInfo{}, err
+			}
+			if err = w.Close(); err != nil {
+				return UploadInfo{}, err
+			}
+			return m.CompleteMultipartUpload(context.Background())
+		},
+		"stream": func(opts PutObjectOptions) (UploadInfo, error) {
+			return c.PutObject(context.Background(), "bucket", "object", io.LimitReader(strings.NewReader(data), int64(len(data))), int64(len(data)), opts)
+		},
+		"no length": func(opts PutObjectOptions) (UploadInfo, error) {
+			return c.PutObject(context.Background(), "bucket", "object", io.LimitReader(strings.NewReader(data), int64(len(data))), -1, opts)
+		},
+	}
+
+	// 各上传方式均使用选定的校验算法，返回分片校验值的组合校验值
+	for _, checksumType := range []ChecksumType{ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256} {
+		for name, upload := range uploads {
+			parts = make(map[string][]byte)
+			info, err := upload(PutObjectOptions{PartSize: absMinPartSize, AutoChecksum: checksumType, DisableContentSha256: true})
+			if err != nil {
+				t.Fatal(name, checksumType, err)
+			}
+			if algorithm != checksumType.String() || len(parts) != 2 {
+				t.Fatal(name, checksumType, "upload error", algorithm, len(parts))
+			}
+
+			var sums []byte
+			for i := 1; i <= len(parts); i++ {
+				sums = append(sums, checksumType.ChecksumBytes(parts[strconv.Itoa(i)]).Raw()...)
+			}
+			expected := checksumType.ChecksumBytes(sums).Encoded()
+			returned := map[ChecksumType]string{
+				ChecksumCRC32:  info.ChecksumCRC32,
+				ChecksumCRC32C: info.ChecksumCRC32C,
+				ChecksumSHA1:   info.ChecksumSHA1,
+				ChecksumSHA256: info.ChecksumSHA256,
+			}[checksumType]
+			if complete != expected || returned != expected {
+				t.Fatal(name, checksumType, "composite checksum error", complete, returned, expected)
+			}
+		}
+	}
+}
+
+func TestClient_AbortStaleUploads(t *testing.T) {
+	var mu sync.Mutex
+	aborted := make(map[string]bool)
+	uploads := []ObjectMultipartInfo{
+		{Key: "dir/a", UploadID: "old1", Initiated: time.Now().Add(-48 * time.Hour)},
+		{Key: "dir/a", UploadID: "new", Initiated: time.Now()},
+		{Key: "dir/b", UploadID: "old2", Initiated: time.Now().Add(-25 * time.Hour)},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Has("uploads"):
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+				ListMultipartUploadsResult
+			}{ListMultipartUploadsResult: ListMultipartUploadsResult{Bucket: "bucket", Uploads: uploads}})
+		case r.Method == http.MethodGet:
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"ListPartsResult"`
+				ListObjectPartsResult
+			}{ListObjectPartsResult: ListObjectPartsResult{ObjectParts: []ObjectPart{
+				{PartNumber: 1, ETag: "\"etag1\"", Size: 10},
+				{PartNumber: 3, ETag: "\"etag3\"", Size: 5},
+			}}})
+		case r.Method == http.MethodDelete:
+			aborted[r.URL.Query().Get("uploadId")] = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 试运行只报告超过一天的上传
+	report, err := c.AbortStaleUploads(context.Background(), "bucket", "dir/", 24*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 3 || len(report.Stale) != 2 || report.Aborted != 0 || len(aborted) != 0 || report.Size != 30 {
+		t.Fatal("dry run report error", report)
+	}
+	if report.Stale[0].UploadID != "old1" || report.Stale[0].PartSizes[3] != 5 {
+		t.Fatal("stale upload error", report.Stale[0])
+	}
+
+	report, err = c.AbortStaleUploadsWithOptions(context.Background(), "bucket", "dir/", AbortStaleUploadsOptions{OlderThan: 24 * time.Hour, NumThreads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Aborted != 2 || !aborted["old1"] || !aborted["old2"] || aborted["new"] {
+		t.Fatal("abort error", report, aborted)
+	}
+}
+
+type countingProgress struct {
+	n int64
+}
+
+func (p *countingProgress) Read(b []byte) (int, error) {
+	p.n += int64(len(b))
+	return len(b), nil
+}
+
+func TestClient_MultipartPartBuffer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"InitiateMultipartUploadResult"`
+				initiateMultipartUploadResult
+			}{initiateMultipartUploadResult: initiateMultipartUploadResult{Bucket: "bucket", Key: "object", UploadID: "upload"}})
+		case r.Method == http.MethodPut:
+			io.Copy(io.Discard, r.Body)
+			w.Header().Set("ETag", "\"etag"+r.URL.Query().Get("partNumber")+"\"")
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未设置分片大小时分片为576MiB，缓冲区只按读到的数据分配
+	progress := &countingProgress{}
+	m, err := c.NewUploadID(context.Background(), "bucket", "object", &PutObjectOptions{Progress: progress, DisableContentSha256: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.opts.PartSize <= 64*1024*1024 {
+		t.Fatal("default part size error", m.opts.PartSize)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for n := 1; n <= 4; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			errs <- m.UploadPart(context.Background(), strings.NewReader(strings.Repeat("a", 3*1024*1024)), n)
+		}(n)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 进度在各协程间串行更新
+	if progress.n != 4*3*1024*1024 {
+		t.Fatal("progress error", progress.n)
+	}
+	bufp := m.bufPool.Get().(*[]byte)
+	if cap(*bufp) > 4*1024*1024 {
+		t.Fatal("part buffer too large", cap(*bufp))
+	}
+
+	// 分片缓冲区不超过分片大小
+	buf := make([]byte, 0, 10)
+	n, err := readPart(strings.NewReader(strings.Repeat("b", 20)), &buf, 15)
+	if n != 15 || err != nil || len(buf) != 15 || cap(buf) != 15 {
+		t.Fatal("read part error", n, err, cap(buf))
+	}
+	n, err = readPart(strings.NewReader("short"), &buf, 15)
+	if n != 5 || err != io.ErrUnexpectedEOF || string(buf) != "short" {
+		t.Fatal("read short part error", n, err)
+	}
+	if n, err = readPart(strings.NewReader(""), &buf, 15); n != 0 || err != io.EOF {
+		t.Fatal("read empty part error", n, err)
+	}
+}
@@ -0,0 +1,209 @@
+package ossClient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/s3utils"
+)
+
+// MultipartUploadState is the persisted state of a MultipartUploader, see
+// MultipartUploader.MarshalJSON and Client.ResumeUploadFromState.
+type MultipartUploadState struct {
+	BucketName   string               `json:"bucket"`
+	ObjectName   string               `json:"object"`
+	UploadID     string               `json:"uploadId"`
+	PartSize     uint64               `json:"partSize"`
+	ChecksumType ChecksumType         `json:"checksumType,omitempty"`
+	Parts        []MultipartPartState `json:"parts"`
+}
+
+// MultipartPartState is an uploaded part recorded in a MultipartUploadState.
+type MultipartPartState struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum,omitempty"` // base64, as sent with the part
+}
+
+// MarshalJSON returns the state of the upload, it can be stored and
+// handed to ResumeUploadFromState to continue the upload in another
+// process. The options of the upload are not part of the state.
+func (m *MultipartUploader) MarshalJSON() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := MultipartUploadState{
+		BucketName: m.BucketName,
+		ObjectName: m.ObjectName,
+		UploadID:   m.UploadID,
+		PartSize:   m.opts.PartSize,
+		Parts:      make([]MultipartPartState, 0, len(m.partsInfo)),
+	}
+	if !m.opts.SendContentMd5 {
+		state.ChecksumType = m.opts.checksumType()
+	}
+	for number, part := range m.partsInfo {
+		p := MultipartPartState{
+			PartNumber: number,
+			ETag:       part.ETag,
+			Size:       part.Size,
+		}
+		if crc, ok := m.crcBytes[number]; ok {
+			p.Checksum = base64.StdEncoding.EncodeToString(crc)
+		}
+		state.Parts = append(state.Parts, p)
+	}
+	sort.Slice(state.Parts, func(i, j int) bool {
+		return state.Parts[i].PartNumber < state.Parts[j].PartNumber
+	})
+
+	return json.Marshal(state)
+}
+
+// NextPartNumber returns the number of the first part not uploaded yet,
+// UploadPart continues there after a resume.
+func (m *MultipartUploader) NextPartNumber() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 1
+	for {
+		if _, ok := m.partsInfo[n]; !ok {
+			return n
+		}
+		n++
+	}
+}
+
+// ResumeUpload continues the multipart upload uploadID of an uploader
+// that is gone, the uploaded parts are listed from the server. Part
+// checksums the server does not list are computed from the part data so
+// CompleteMultipartUpload can send the checksum of the whole object.
+// opts must be the options the upload was started with, a zero PartSize
+// is taken from the first part.
+func (c *Client) ResumeUpload(ctx context.Context, bucketName, objectName, uploadID string, opts *PutObjectOptions) (*MultipartUploader, error) {
+	return c.resumeUpload(ctx, bucketName, objectName, uploadID, nil, opts)
+}
+
+// ResumeUploadFromState continues the upload described by state, as
+// returned by MultipartUploader.MarshalJSON. Every recorded part is
+// verified against the server: its ETag and checksum must not have changed.
+// Parts the state does not know about are taken over from the server.
+func (c *Client) ResumeUploadFromState(ctx context.Context, state []byte, opts *PutObjectOptions) (*MultipartUploader, error) {
+	var s MultipartUploadState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, err
+	}
+	if opts.PartSize == 0 {
+		opts.PartSize = s.PartSize
+	}
+	if opts.AutoChecksum == ChecksumNone {
+		opts.AutoChecksum = s.ChecksumType
+	}
+	return c.resumeUpload(ctx, s.BucketName, s.ObjectName, s.UploadID, s.Parts, opts)
+}
+
+func (c *Client) resumeUpload(ctx context.Context, bucketName, objectName, uploadID string, recorded []MultipartPartState, opts *PutObjectOptions) (*MultipartUploader, error) {
+	if opts.DisableMultipart {
+		return nil, errors.New("multipart disabled")
+	}
+	if err := s3utils.CheckValidBucketName(bucketName); err != nil {
+		return nil, err
+	}
+	if err := s3utils.CheckValidObjectName(objectName); err != nil {
+		return nil, err
+	}
+	if uploadID == "" {
+		return nil, errInvalidArgument("upload ID cannot be empty")
+	}
+	if err := opts.validateChecksum(); err != nil {
+		return nil, err
+	}
+
+	partsInfo, err := c.listObjectParts(ctx, bucketName, objectName, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	checksumType := opts.checksumType()
+	sums := make(map[int]string, len(partsInfo))
+	for number, part := range partsInfo {
+		sums[number] = part.Checksum(checksumType)
+	}
+	for _, r := range recorded {
+		part, ok := partsInfo[r.PartNumber]
+		if !ok {
+			return nil, fmt.Errorf("part %d of upload %s is recorded but missing on the server", r.PartNumber, uploadID)
+		}
+		if trimEtag(part.ETag) != trimEtag(r.ETag) || part.Size != r.Size {
+			return nil, fmt.Errorf("part %d of upload %s was replaced after the state was saved", r.PartNumber, uploadID)
+		}
+		if r.Checksum != "" && sums[r.PartNumber] != "" && sums[r.PartNumber] != r.Checksum {
+			return nil, fmt.Errorf("part %d of upload %s has %s %s on the server, %s was recorded",
+				r.PartNumber, uploadID, checksumType, sums[r.PartNumber], r.Checksum)
+		}
+		if sums[r.PartNumber] == "" {
+			sums[r.PartNumber] = r.Checksum
+		}
+	}
+
+	if opts.PartSize == 0 {
+		if part, ok := partsInfo[1]; ok {
+			opts.PartSize = uint64(part.Size)
+		}
+	}
+	_, partSize, _, err := OptimalPartInfo(-1, opts.PartSize)
+	if err != nil {
+		return nil, err
+	}
+	opts.PartSize = uint64(partSize)
+
+	m := c.newMultipartUploader(bucketName, objectName, uploadID, opts, partsInfo)
+	if opts.SendContentMd5 {
+		return m, nil
+	}
+
+	for number, sum := range sums {
+		if sum != "" {
+			crc, err := base64.StdEncoding.DecodeString(sum)
+			if err != nil || len(crc) != checksumType.RawByteLen() {
+				return nil, fmt.Errorf("part %d of upload %s has an invalid %s %q", number, uploadID, checksumType, sum)
+			}
+			m.crcBytes[number] = crc
+			continue
+		}
+
+		crc, err := m.partChecksum(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		m.crcBytes[number] = crc
+	}
+
+	return m, nil
+}
+
+// partChecksum computes the checksum of an uploaded part from its data.
+func (m *MultipartUploader) partChecksum(ctx context.Context, partNumber int) ([]byte, error) {
+	r, _, err := m.getPart(ctx, partNumber, GetObjectOptions{ServerSideEncryption: m.opts.ServerSideEncryption})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	hasher := m.opts.checksumType().Hasher()
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return nil, err
+	}
+	if n != m.partsInfo[partNumber].Size {
+		return nil, fmt.Errorf("part %d of upload %s has %d bytes, %d were listed", partNumber, m.UploadID, n, m.partsInfo[partNumber].Size)
+	}
+	return hasher.Sum(nil), nil
+}
@@ -0,0 +1,165 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Writer returns a writer slicing everything written to it into parts of
+// PartSize bytes, numbered on from the highest uploaded part so no part is
+// overwritten. Up to NumThreads of the upload options parts are uploaded
+// in parallel, each in a buffer of the pool of the uploader, so the writer
+// holds up to NumThreads+1 parts in memory; set PartSize when the upload is
+// created, the part size chosen for an unknown object size is 576MiB. Close uploads
+// the last, short part and waits for all uploads, CompleteMultipartUpload
+// can be called once Close returned without an error. The first failed
+// upload fails all following writes and Close.
+func (m *MultipartUploader) Writer(ctx context.Context) io.WriteCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	numThreads := m.opts.getNumThreads()
+	m.mu.Lock()
+	partNumber := m.lastPartNumber() + 1
+	m.mu.Unlock()
+	return &multipartWriter{
+		m:          m,
+		ctx:        ctx,
+		cancel:     cancel,
+		partSize:   int(m.opts.PartSize),
+		partNumber: partNumber,
+		sem:        make(chan struct{}, numThreads),
+	}
+}
+
+type multipartWriter struct {
+	m      *MultipartUploader
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	buf        *[]byte // part being filled
+	partSize   int
+	partNumber int
+
+	sem    chan struct{} // one slot per upload in flight
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// Write implements io.Writer.
+func (w *multipartWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed multipart writer")
+	}
+
+	var written int
+	for len(p) > 0 {
+		if err := w.failed(); err != nil {
+			return written, err
+		}
+		if w.buf == nil {
+			w.buf = w.m.bufPool.Get().(*[]byte)
+			*w.buf = (*w.buf)[:0]
+		}
+		n := w.partSize - len(*w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		*w.buf = append(growPartBuffer(*w.buf, n, w.partSize), p[:n]...)
+		written += n
+		p = p[n:]
+		if len(*w.buf) == w.partSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close implements io.Closer.
+func (w *multipartWriter) Close() error {
+	if w.closed {
+		return w.failed()
+	}
+	w.closed = true
+
+	var err error
+	if w.buf != nil && len(*w.buf) > 0 {
+		err = w.flush()
+	} else {
+		w.release()
+	}
+	w.wg.Wait()
+	w.cancel()
+	if err != nil {
+		return err
+	}
+	if err = w.failed(); err != nil {
+		return err
+	}
+
+	w.m.mu.Lock()
+	w.m.eof = true
+	w.m.mu.Unlock()
+	return nil
+}
+
+// flush hands the filled buffer to an upload goroutine, it blocks while
+// all slots are taken.
+func (w *multipartWriter) flush() error {
+	if w.partNumber > maxPartsCount {
+		w.setErr(errInvalidArgument(fmt.Sprintf("Part number %d exceeds the maximum of %d parts.", w.partNumber, maxPartsCount)))
+		w.release()
+		return w.failed()
+	}
+
+	select {
+	case w.sem <- struct{}{}:
+	case <-w.ctx.Done():
+		w.setErr(w.ctx.Err())
+		w.release()
+		return w.failed()
+	}
+
+	buf, length, partNumber := w.buf, len(*w.buf), w.partNumber
+	w.buf = nil
+	w.partNumber++
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if err := w.m.uploadPart(w.ctx, *buf, length, partNumber); err != nil {
+			w.setErr(err)
+		}
+		w.m.bufPool.Put(buf)
+		<-w.sem
+	}()
+	return nil
+}
+
+// release returns the buffer being filled to the pool.
+func (w *multipartWriter) release() {
+	if w.buf != nil {
+		w.m.bufPool.Put(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *multipartWriter) setErr(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+	w.mu.Unlock()
+}
+
+func (w *multipartWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
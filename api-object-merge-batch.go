@@ -0,0 +1,216 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	// defaultMergeRangeGap - largest hole between two entries that is
+	// still read in one ranged GET.
+	defaultMergeRangeGap = 1024 * 64
+	// defaultMergeRangeSize - largest ranged GET built by coalescing.
+	defaultMergeRangeSize = 1024 * 1024 * 8
+)
+
+// GetObjectsWithIndexOptions configures GetObjectsWithIndex.
+type GetObjectsWithIndexOptions struct {
+	Index        *ObjectIndexInfo // index of the pack, downloaded when nil
+	MaxGap       int64            // largest hole read between two entries of one GET, default 64KiB, negative only merges adjacent entries
+	MaxRangeSize int64            // largest coalesced GET, default 8MiB, a single larger entry is still read at once
+	NumThreads   int              // parallel GETs, default 4
+	GetOptions   GetObjectOptions // options of every GET, e.g. the SSE-C key of the pack
+}
+
+// mergeRangeEntry is one requested entry inside a coalesced range.
+type mergeRangeEntry struct {
+	name string
+	idx  *ObjectIndex
+}
+
+// mergeRange is a byte range of the data object covering one or more entries.
+type mergeRange struct {
+	start, end int64 // end is exclusive
+	entries    []mergeRangeEntry
+}
+
+// coalesceMergeRanges sorts the entries by offset and merges entries whose
+// distance is at most maxGap into one range of at most maxSize bytes.
+func coalesceMergeRanges(entries []mergeRangeEntry, maxGap, maxSize int64) []mergeRange {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].idx.Offset < entries[j].idx.Offset
+	})
+
+	var ranges []mergeRange
+	for _, e := range entries {
+		end := e.idx.Offset + e.idx.Size
+		if n := len(ranges); n > 0 {
+			last := &ranges[n-1]
+			if e.idx.Offset-last.end <= maxGap && end-last.start <= maxSize {
+				if end > last.end {
+					last.end = end
+				}
+				last.entries = append(last.entries, e)
+				continue
+			}
+		}
+		ranges = append(ranges, mergeRange{
+			start:   e.idx.Offset,
+			end:     end,
+			entries: []mergeRangeEntry{e},
+		})
+	}
+
+	return ranges
+}
+
+// GetObjectsWithIndex reads many entries of a merge pack with few ranged
+// GETs. Entries close to each other in the data object are fetched by one
+// request, requests run in parallel and fn is called once per entry, never
+// concurrently. The data passed to fn is not reused by GetObjectsWithIndex.
+// The first error returned by fn or by a request stops the reads.
+func (c *Client) GetObjectsWithIndex(ctx context.Context, bucketName, id string, names []string,
+	fn func(objectName string, data []byte) error, opts GetObjectsWithIndexOptions,
+) error {
+	meta := opts.Index
+	if meta == nil {
+		var err error
+		meta, err = c.GetObjectIndexInfo(ctx, id, bucketName)
+		if err != nil {
+			return err
+		}
+	}
+
+	maxGap := opts.MaxGap
+	if maxGap == 0 {
+		maxGap = defaultMergeRangeGap
+	} else if maxGap < 0 {
+		maxGap = 0
+	}
+	maxSize := opts.MaxRangeSize
+	if maxSize <= 0 {
+		maxSize = defaultMergeRangeSize
+	}
+	numThreads := opts.NumThreads
+	if numThreads <= 0 {
+		numThreads = totalWorkers
+	}
+
+	seen := make(map[string]bool, len(names))
+	entries := make([]mergeRangeEntry, 0, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		idx, ok := meta.Info[name]
+		if !ok {
+			return errors.New("object not found: " + name)
+		} else if !idx.Valid {
+			return errors.New("object invalid: " + name)
+		}
+		entries = append(entries, mergeRangeEntry{name: name, idx: idx})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		fnMutex  sync.Mutex
+		errOnce  sync.Once
+		firstErr error
+	)
+	setErr := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	rangeCh := make(chan mergeRange)
+	for i := 0; i < numThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rangeCh {
+				err := c.getMergeRange(ctx, bucketName, id, meta, opts.GetOptions, r, func(name string, data []byte) error {
+					fnMutex.Lock()
+					defer fnMutex.Unlock()
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					return fn(name, data)
+				})
+				if err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, r := range coalesceMergeRanges(entries, maxGap, maxSize) {
+		select {
+		case rangeCh <- r:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(rangeCh)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// getMergeRange downloads one coalesced range and hands out its entries.
+func (c *Client) getMergeRange(ctx context.Context, bucketName, id string, meta *ObjectIndexInfo, getOpts GetObjectOptions, r mergeRange,
+	fn func(objectName string, data []byte) error,
+) error {
+	opts := getOpts.clone()
+	if err := opts.SetRange(r.start, r.end-1); err != nil {
+		return err
+	}
+	if meta.DataETag != "" {
+		opts.SetMatchETag(meta.DataETag)
+	}
+	opts.VersionID = meta.DataVersionID
+
+	reader, _, _, err := c.getObject(ctx, bucketName, meta.dataObjectName(id), opts)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	buf := make([]byte, r.end-r.start)
+	if _, err = io.ReadFull(reader, buf); err != nil {
+		return err
+	}
+
+	for _, e := range r.entries {
+		data := buf[e.idx.Offset-r.start : e.idx.Offset-r.start+e.idx.Size : e.idx.Offset-r.start+e.idx.Size]
+		if e.idx.Checksum != "" && e.idx.ChecksumType.IsSet() {
+			actual := e.idx.ChecksumType.ChecksumBytes(data).Encoded()
+			if actual != e.idx.Checksum {
+				return MergeChecksumError{
+					ObjectName: e.name,
+					Type:       e.idx.ChecksumType,
+					Expected:   e.idx.Checksum,
+					Actual:     actual,
+				}
+			}
+		}
+		if err = fn(e.name, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
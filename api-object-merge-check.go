@@ -0,0 +1,244 @@
+package ossClient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MergeOrphanGracePeriod - indexes without data, data objects without
+// index and data objects replaced by a compaction younger than this are
+// assumed to belong to a commit or compaction still in progress and are
+// not reported by CheckMergePacks.
+var MergeOrphanGracePeriod = 15 * time.Minute
+
+// MergePackProblem is the kind of inconsistency found by CheckMergePacks.
+type MergePackProblem string
+
+const (
+	// MergeIndexWithoutData - the index references a data object that does not exist.
+	MergeIndexWithoutData MergePackProblem = "IndexWithoutData"
+	// MergeDataWithoutIndex - a data object no index refers to, left by an interrupted commit.
+	MergeDataWithoutIndex MergePackProblem = "DataWithoutIndex"
+	// MergeEntryOutOfRange - valid entries end past the length of the data object.
+	MergeEntryOutOfRange MergePackProblem = "EntryOutOfRange"
+	// MergeDataETagMismatch - the data object changed after the index was committed.
+	MergeDataETagMismatch MergePackProblem = "DataETagMismatch"
+	// MergeCompactLeftover - a data object the index no longer refers to,
+	// written by an interrupted compaction or replaced by a compaction that
+	// could not remove it.
+	MergeCompactLeftover MergePackProblem = "CompactLeftover"
+)
+
+// MergePackIssue is one inconsistency found by CheckMergePacks.
+type MergePackIssue struct {
+	ID       string
+	Problem  MergePackProblem
+	Entries  []string // entries concerned by MergeEntryOutOfRange
+	Detail   string
+	Repaired bool
+	Err      error // error of the repair
+}
+
+// mergeCheckObject - what the listing tells about a merge pack.
+type mergeCheckObject struct {
+	index *ObjectInfo
+	data  []ObjectInfo // the DataPrefix object and the objects written by compactions
+}
+
+// CheckMergePacks verifies every merge pack of the bucket and reports
+// indexes without data, data objects without index, entries past the end
+// of the data object and data objects changed behind the index. With
+// repair set, orphaned objects are removed and indexes are rebuilt so
+// they only reference existing data.
+func (c *Client) CheckMergePacks(ctx context.Context, bucketName string, repair bool) ([]MergePackIssue, error) {
+	err := checkBucket(c, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	packs := make(map[string]*mergeCheckObject)
+	pack := func(id string) *mergeCheckObject {
+		if packs[id] == nil {
+			packs[id] = &mergeCheckObject{}
+		}
+		return packs[id]
+	}
+	for object := range c.ListObjects(ctx, bucketName, ListObjectsOptions{Prefix: MergeDir, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		object := object
+		name := strings.TrimPrefix(object.Key, MergeDir)
+		switch {
+		case strings.HasPrefix(name, IdxPrefix):
+			pack(strings.TrimPrefix(name, IdxPrefix)).index = &object
+		case strings.HasPrefix(name, DataPrefix):
+			p := pack(strings.TrimPrefix(name, DataPrefix))
+			p.data = append(p.data, object)
+		case strings.HasPrefix(name, GenerationPrefix):
+			gen := strings.TrimPrefix(name, GenerationPrefix)
+			if i := strings.LastIndex(gen, "."); i > 0 {
+				p := pack(gen[:i])
+				p.data = append(p.data, object)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(packs))
+	for id := range packs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var issues []MergePackIssue
+	for _, id := range ids {
+		p := packs[id]
+
+		var meta *ObjectIndexInfo
+		var indexETag string
+		if p.index != nil {
+			meta, indexETag, err = c.getObjectIndexInfo(ctx, id, bucketName)
+			if ToErrorResponse(err).Code == "NoSuchKey" {
+				// Deleted since the listing.
+				continue
+			}
+			if err != nil {
+				return issues, err
+			}
+		}
+
+		// Every data object but the one the index refers to is left over
+		// by an interrupted commit or compaction.
+		var data *ObjectInfo
+		for i := range p.data {
+			object := &p.data[i]
+			if meta != nil && object.Key == meta.dataObjectName(id) {
+				data = object
+				continue
+			}
+			if time.Since(object.LastModified) < MergeOrphanGracePeriod {
+				continue
+			}
+			issue := MergePackIssue{ID: id, Problem: MergeDataWithoutIndex, Detail: object.Key}
+			if meta != nil {
+				issue.Problem = MergeCompactLeftover
+			}
+			if repair {
+				issue.Err = c.removeObject(ctx, bucketName, object.Key, RemoveObjectOptions{GovernanceBypass: true}).Err
+				issue.Repaired = issue.Err == nil
+			}
+			issues = append(issues, issue)
+		}
+
+		switch {
+		case meta != nil && data == nil:
+			if time.Since(p.index.LastModified) < MergeOrphanGracePeriod {
+				continue
+			}
+			// The listing is no snapshot, the index may refer to a data
+			// object written after it was listed.
+			_, err = c.StatObject(ctx, bucketName, meta.dataObjectName(id), StatObjectOptions{})
+			if err == nil {
+				continue
+			}
+			if ToErrorResponse(err).Code != "NoSuchKey" {
+				return issues, err
+			}
+			issue := MergePackIssue{ID: id, Problem: MergeIndexWithoutData, Detail: meta.dataObjectName(id)}
+			if repair {
+				if cache := c.indexCache(); cache != nil {
+					cache.Delete(bucketName, id)
+				}
+				// Only the index just read, a writer may have replaced it.
+				opts := RemoveObjectOptions{GovernanceBypass: true}
+				opts.SetMatchETag(indexETag)
+				issue.Err = c.removeObject(ctx, bucketName, p.index.Key, opts).Err
+				issue.Repaired = issue.Err == nil
+			}
+			issues = append(issues, issue)
+		case meta != nil:
+			packIssues, err := c.checkMergePack(ctx, bucketName, id, meta, *data, repair)
+			if err != nil {
+				return issues, err
+			}
+			issues = append(issues, packIssues...)
+		}
+	}
+
+	return issues, nil
+}
+
+// checkMergePack compares the index of a pack with its data object.
+func (c *Client) checkMergePack(ctx context.Context, bucketName, id string, meta *ObjectIndexInfo, data ObjectInfo, repair bool) ([]MergePackIssue, error) {
+	var outOfRange []string
+	for name, idx := range meta.Info {
+		if idx.Valid && idx.Offset+idx.Size > data.Size {
+			outOfRange = append(outOfRange, name)
+		}
+	}
+	sort.Strings(outOfRange)
+	// ETags of listings and of HEAD requests may differ in quoting.
+	mismatch := meta.DataETag != "" && trimEtag(meta.DataETag) != trimEtag(data.ETag)
+
+	var issues []MergePackIssue
+	if len(outOfRange) > 0 {
+		issues = append(issues, MergePackIssue{
+			ID:      id,
+			Problem: MergeEntryOutOfRange,
+			Entries: outOfRange,
+			Detail:  fmt.Sprintf("%d entries end past the data size %d", len(outOfRange), data.Size),
+		})
+	}
+	// A grown data object is an append that lost its index update, the
+	// entries are still in place. A shrunk one was rewritten and the
+	// remaining offsets can not be trusted, only the entries past the end
+	// are repaired.
+	if mismatch {
+		detail := "data object was appended to after the index was committed"
+		if data.Size < meta.TotalSize {
+			detail = "data object was rewritten after the index was committed"
+		}
+		issues = append(issues, MergePackIssue{ID: id, Problem: MergeDataETagMismatch, Detail: detail})
+	}
+	if len(issues) == 0 || !repair {
+		return issues, nil
+	}
+
+	_, err := c.updateObjectIndexInfo(ctx, id, bucketName, func(meta *ObjectIndexInfo) error {
+		if meta.dataObjectName(id) != data.Key {
+			return fmt.Errorf("merge pack %s was compacted during the check", id)
+		}
+		trusted := meta.DataETag == "" || trimEtag(meta.DataETag) == trimEtag(data.ETag) || data.Size >= meta.TotalSize
+
+		var validSize int64
+		for _, idx := range meta.Info {
+			if idx.Valid && idx.Offset+idx.Size > data.Size {
+				idx.Valid = false
+			}
+			if idx.Valid {
+				validSize += idx.Size
+			}
+		}
+		if trusted {
+			meta.TotalSize = data.Size
+			meta.DataETag = data.ETag
+			// The listing holds no version, reads follow the latest
+			// one which the ETag pins.
+			meta.DataVersionID = data.VersionID
+		}
+		meta.VacancySize = meta.TotalSize - validSize
+		return nil
+	})
+	for i := range issues {
+		issues[i].Err = err
+		issues[i].Repaired = err == nil
+		if issues[i].Problem == MergeDataETagMismatch && data.Size < meta.TotalSize {
+			issues[i].Repaired = false
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,233 @@
+package ossClient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	uuid2 "github.com/google/uuid"
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+// CompactMergePackOptions configures CompactMergePack.
+type CompactMergePackOptions struct {
+	// MinVacancyRatio skips the compaction while VacancySize/TotalSize is
+	// below it, 0 always compacts.
+	MinVacancyRatio float64
+	// Upload configures how the compacted data object is buffered.
+	Upload MergeUploadOptions
+}
+
+// MergeCompactionPolicy compacts a merge pack automatically after
+// DeleteObjectWithId, or ExtractMergeEntryWithOptions invalidating the
+// entry, once its vacancy ratio reaches MinVacancyRatio. The compaction
+// runs before the call returns and copies every valid entry of the pack,
+// so a delete of a few bytes may take as long as rewriting the whole pack.
+// The delete does not fail with the compaction, a failed compaction is
+// passed to OnError if set and retried by the next delete.
+type MergeCompactionPolicy struct {
+	MinVacancyRatio float64
+	Upload          MergeUploadOptions
+	OnError         func(bucketName, id string, err error)
+}
+
+// CompactMergePackInfo describes the result of CompactMergePack.
+type CompactMergePackInfo struct {
+	Compacted     bool  // false if skipped by MinVacancyRatio
+	OldTotalSize  int64 // data object size before the compaction
+	NewTotalSize  int64 // data object size after the compaction
+	ReclaimedSize int64
+	ObjectNum     int // valid entries left in the pack
+}
+
+// SetMergeCompactionPolicy enables automatic compaction of merge packs
+// in DeleteObjectWithId, a nil policy disables it, which is the default.
+// It may be called while the client is in use, the policy is copied.
+func (c *Client) SetMergeCompactionPolicy(policy *MergeCompactionPolicy) {
+	if policy != nil {
+		p := *policy
+		policy = &p
+	}
+	c.mergeCompaction.Store(policy)
+}
+
+// compactionPolicy returns the merge compaction policy, nil if disabled.
+func (c *Client) compactionPolicy() *MergeCompactionPolicy {
+	policy, _ := c.mergeCompaction.Load().(*MergeCompactionPolicy)
+	return policy
+}
+
+// vacancyRatio returns VacancySize/TotalSize of the pack.
+func (m *ObjectIndexInfo) vacancyRatio() float64 {
+	if m.TotalSize == 0 {
+		return 0
+	}
+	return float64(m.VacancySize) / float64(m.TotalSize)
+}
+
+// CompactMergePack rewrites the data object of a merge pack without the
+// ranges of invalid entries and rewrites the index with the new offsets.
+//
+// The compacted data is written to a new data object, the index switches
+// to it with a PUT that only succeeds if the index ETag still matches, so
+// readers and writers see either the old or the new data object in full.
+// The old data object is removed once the new index is in place. Data
+// objects left by an interrupted compaction are found by CheckMergePacks.
+func (c *Client) CompactMergePack(ctx context.Context, bucketName, id string, opts CompactMergePackOptions) (CompactMergePackInfo, error) {
+	err := checkBucket(c, bucketName)
+	if err != nil {
+		return CompactMergePackInfo{}, err
+	}
+
+	meta, etag, err := c.getObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return CompactMergePackInfo{}, err
+	}
+
+	info := CompactMergePackInfo{
+		OldTotalSize: meta.TotalSize,
+		NewTotalSize: meta.TotalSize,
+	}
+	if meta.VacancySize == 0 || meta.vacancyRatio() < opts.MinVacancyRatio {
+		for _, idx := range meta.Info {
+			if idx.Valid {
+				info.ObjectNum++
+			}
+		}
+		return info, nil
+	}
+
+	names := make([]string, 0, len(meta.Info))
+	for name, idx := range meta.Info {
+		if idx.Valid {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return meta.Info[names[i]].Offset < meta.Info[names[j]].Offset
+	})
+
+	putOpts, err := mergeDataPutOptions(meta, opts.Upload.Pack.ServerSideEncryption)
+	if err != nil {
+		return CompactMergePackInfo{}, err
+	}
+	oldName := meta.dataObjectName(id)
+	dataTags, err := c.GetObjectTagging(ctx, bucketName, oldName, GetObjectTaggingOptions{VersionID: meta.DataVersionID})
+	if err != nil {
+		return CompactMergePackInfo{}, err
+	}
+	putOpts.UserTags = dataTags.ToMap()
+
+	uuid, err := uuid2.NewRandom()
+	if err != nil {
+		return CompactMergePackInfo{}, err
+	}
+	newName := GenerationPrefix + id + "." + uuid.String()
+	newMeta, dataInfo, err := c.writeCompactedData(ctx, bucketName, id, MergeDir+newName, meta, names, opts.Upload, putOpts)
+	if err != nil {
+		return CompactMergePackInfo{}, err
+	}
+	newMeta.DataObject = newName
+	newMeta.DataETag = dataInfo.ETag
+	newMeta.DataVersionID = dataInfo.VersionID
+
+	_, err = c.putObjectIndexInfo(ctx, id, bucketName, newMeta, etag, PutObjectOptions{UserTags: dataTags.ToMap()})
+	if err != nil {
+		// The index still refers to the old data object.
+		c.removeObject(ctx, bucketName, MergeDir+newName, RemoveObjectOptions{GovernanceBypass: true, VersionID: dataInfo.VersionID})
+		if isPreconditionFailed(err) {
+			return CompactMergePackInfo{}, MergeIndexConflictError{ID: id, Attempts: 1}
+		}
+		return CompactMergePackInfo{}, err
+	}
+
+	// Readers holding the old index reload it once the old data object is
+	// gone, on versioned buckets they keep reading the retained version. A
+	// failed removal leaves the object to CheckMergePacks.
+	c.removeObject(ctx, bucketName, oldName, RemoveObjectOptions{GovernanceBypass: true})
+
+	info.Compacted = true
+	info.NewTotalSize = newMeta.TotalSize
+	info.ReclaimedSize = meta.TotalSize - newMeta.TotalSize
+	info.ObjectNum = newMeta.ObjectNum
+	return info, nil
+}
+
+// writeCompactedData streams the valid entries of the data object in
+// offset order to objectName and returns the index with the new offsets
+// along with the written object.
+func (c *Client) writeCompactedData(ctx context.Context, bucketName, id, objectName string, meta *ObjectIndexInfo, names []string,
+	opts MergeUploadOptions, putOpts PutObjectOptions,
+) (*ObjectIndexInfo, UploadInfo, error) {
+	data, err := newMergeDataWriter(c, bucketName, objectName, opts, putOpts)
+	if err != nil {
+		return nil, UploadInfo{}, err
+	}
+	defer data.release(ctx)
+
+	newMeta := &ObjectIndexInfo{
+		Info:    make(map[string]*ObjectIndex, len(names)),
+		Format:  meta.Format,
+		Storage: meta.Storage,
+	}
+
+	if len(names) > 0 {
+		getOpts := GetObjectOptions{ServerSideEncryption: encrypt.SSE(putOpts.ServerSideEncryption)}
+		if meta.DataETag != "" {
+			getOpts.SetMatchETag(meta.DataETag)
+		}
+		getOpts.VersionID = meta.DataVersionID
+		src, _, _, err := c.getObject(ctx, bucketName, meta.dataObjectName(id), getOpts)
+		if err != nil {
+			return nil, UploadInfo{}, err
+		}
+		defer src.Close()
+
+		var pos int64
+		for _, name := range names {
+			idx := meta.Info[name]
+			if idx.Offset < pos {
+				return nil, UploadInfo{}, fmt.Errorf("merge index %s has overlapping entry %s", id, name)
+			}
+			if _, err = io.CopyN(io.Discard, src, idx.Offset-pos); err != nil {
+				return nil, UploadInfo{}, err
+			}
+			if _, err = io.CopyN(data, src, idx.Size); err != nil {
+				return nil, UploadInfo{}, err
+			}
+			pos = idx.Offset + idx.Size
+
+			entry := *idx
+			entry.Offset = newMeta.TotalSize
+			newMeta.Info[name] = &entry
+			newMeta.TotalSize += idx.Size
+			newMeta.ObjectNum++
+		}
+	}
+
+	info, err := data.commit(ctx, c, bucketName, objectName, newMeta.TotalSize, putOpts)
+	if err != nil {
+		return nil, UploadInfo{}, err
+	}
+
+	return newMeta, info, nil
+}
+
+// compactByPolicy runs the client compaction policy against the pack
+// after an operation that already succeeded, a failed compaction is only
+// reported to the OnError callback of the policy.
+func (c *Client) compactByPolicy(ctx context.Context, bucketName, id string, meta *ObjectIndexInfo) {
+	policy := c.compactionPolicy()
+	if policy == nil || meta.vacancyRatio() < policy.MinVacancyRatio {
+		return
+	}
+
+	_, err := c.CompactMergePack(ctx, bucketName, id, CompactMergePackOptions{
+		MinVacancyRatio: policy.MinVacancyRatio,
+		Upload:          policy.Upload,
+	})
+	if err != nil && policy.OnError != nil {
+		policy.OnError(bucketName, id, fmt.Errorf("merge pack compaction failed: %w", err))
+	}
+}
@@ -0,0 +1,88 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+// ExtractMergeEntryOptions configures ExtractMergeEntryWithOptions.
+type ExtractMergeEntryOptions struct {
+	// Mark the entry invalid in the index once it was copied, the entry is
+	// left alone if it changed meanwhile.
+	Invalidate bool
+	// SSE-C key of the data object of the pack.
+	Encryption encrypt.ServerSide
+}
+
+// ExtractMergeEntry copies the entry name of the merge pack id to the
+// standalone object dst with a server-side copy of its byte range, the
+// data never passes through the client. Unless dst replaces the metadata,
+// the content type and user metadata recorded for the entry are set on
+// the new object.
+func (c *Client) ExtractMergeEntry(ctx context.Context, bucketName, id, name string, dst CopyDestOptions) (UploadInfo, error) {
+	return c.ExtractMergeEntryWithOptions(ctx, bucketName, id, name, dst, ExtractMergeEntryOptions{})
+}
+
+// ExtractMergeEntryWithOptions is ExtractMergeEntry which can also drop
+// the entry from the pack. With a compaction policy set, see
+// SetMergeCompactionPolicy, the pack may then be compacted before it returns.
+func (c *Client) ExtractMergeEntryWithOptions(ctx context.Context, bucketName, id, name string, dst CopyDestOptions, opts ExtractMergeEntryOptions) (UploadInfo, error) {
+	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	idx, ok := meta.Info[name]
+	if !ok {
+		return UploadInfo{}, errors.New("object not found")
+	} else if !idx.Valid {
+		return UploadInfo{}, errors.New("object invalid")
+	}
+
+	src := CopySrcOptions{
+		Bucket:     bucketName,
+		Object:     meta.dataObjectName(id),
+		VersionID:  meta.DataVersionID,
+		MatchETag:  meta.DataETag,
+		MatchRange: true,
+		Start:      idx.Offset,
+		End:        idx.Offset + idx.Size - 1,
+		Encryption: opts.Encryption,
+	}
+	if !dst.ReplaceMetadata && (idx.ContentType != "" || len(idx.UserMetadata) > 0) {
+		dst.UserMetadata = make(map[string]string, len(idx.UserMetadata)+1)
+		for k, v := range idx.UserMetadata {
+			dst.UserMetadata[k] = v
+		}
+		if idx.ContentType != "" {
+			dst.UserMetadata["Content-Type"] = idx.ContentType
+		}
+		dst.ReplaceMetadata = true
+	}
+
+	info, err := c.ComposeObject(ctx, dst, src)
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	if !opts.Invalidate {
+		return info, nil
+	}
+
+	meta, err = c.updateObjectIndexInfo(ctx, id, bucketName, func(meta *ObjectIndexInfo) error {
+		cur, ok := meta.Info[name]
+		if !ok || !cur.Valid || cur.Offset != idx.Offset || cur.Size != idx.Size || cur.Checksum != idx.Checksum {
+			return fmt.Errorf("merge entry %s changed while it was extracted", name)
+		}
+		cur.Valid = false
+		meta.VacancySize += cur.Size
+		return nil
+	})
+	if err != nil {
+		return info, err
+	}
+
+	c.compactByPolicy(ctx, bucketName, id, meta)
+	return info, nil
+}
@@ -0,0 +1,407 @@
+package ossClient
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MergePackFSOptions configures MergePackFSWithOptions.
+type MergePackFSOptions struct {
+	Index      *ObjectIndexInfo // index of the pack, downloaded when nil
+	GetOptions GetObjectOptions // options of the reads of the data object, e.g. the SSE-C key of the pack
+}
+
+// MergeFS is a read-only fs.FS view of a merge pack. Entry names are
+// paths, every `/` separated prefix of a name is a directory. An entry
+// whose name is also the prefix of another entry is hidden by the
+// directory, names that are not valid fs paths (empty elements, "." or
+// "..") are left out. Only the valid entries of the index the view was
+// created with are visible.
+type MergeFS struct {
+	ctx        context.Context
+	client     *Client
+	bucketName string
+	id         string
+	meta       *ObjectIndexInfo
+	getOpts    GetObjectOptions
+
+	files map[string]*mergeFileInfo
+	dirs  map[string][]fs.DirEntry
+}
+
+var (
+	_ fs.ReadDirFS = (*MergeFS)(nil)
+	_ fs.StatFS    = (*MergeFS)(nil)
+)
+
+// MergePackFS returns a fs.FS view of the merge pack id, so it can be
+// served by http.FileServer or parsed by template.ParseFS. ctx is used by
+// every read of the returned file system.
+func MergePackFS(ctx context.Context, client *Client, bucketName, id string) (*MergeFS, error) {
+	return MergePackFSWithOptions(ctx, client, bucketName, id, MergePackFSOptions{})
+}
+
+// MergePackFSWithOptions is MergePackFS with an already loaded index or
+// options of the reads.
+func MergePackFSWithOptions(ctx context.Context, client *Client, bucketName, id string, opts MergePackFSOptions) (*MergeFS, error) {
+	meta := opts.Index
+	if meta == nil {
+		var err error
+		meta, err = client.GetObjectIndexInfo(ctx, id, bucketName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fsys := &MergeFS{
+		ctx:        ctx,
+		client:     client,
+		bucketName: bucketName,
+		id:         id,
+		meta:       meta,
+		getOpts:    opts.GetOptions,
+		files:      make(map[string]*mergeFileInfo),
+		dirs:       map[string][]fs.DirEntry{".": nil},
+	}
+
+	// Directories first, so entries shadowed by a directory are known.
+	for name, idx := range meta.Info {
+		name = strings.TrimPrefix(name, "/")
+		if !idx.Valid || !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			if _, ok := fsys.dirs[dir]; ok {
+				break
+			}
+			fsys.dirs[dir] = nil
+		}
+	}
+	for name, idx := range meta.Info {
+		entry := name
+		name = strings.TrimPrefix(name, "/")
+		if !idx.Valid || !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if _, ok := fsys.dirs[name]; ok {
+			continue
+		}
+		fsys.files[name] = &mergeFileInfo{name: path.Base(name), entry: entry, idx: idx}
+	}
+
+	for name, info := range fsys.files {
+		dir := path.Dir(name)
+		fsys.dirs[dir] = append(fsys.dirs[dir], info)
+	}
+	for name := range fsys.dirs {
+		if name != "." {
+			dir := path.Dir(name)
+			fsys.dirs[dir] = append(fsys.dirs[dir], &mergeFileInfo{name: path.Base(name), dir: true})
+		}
+	}
+	for _, entries := range fsys.dirs {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+	}
+
+	return fsys, nil
+}
+
+// Open opens the named file or directory.
+func (fsys *MergeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if entries, ok := fsys.dirs[name]; ok {
+		return &mergeDir{info: fsys.dirInfo(name), entries: entries}, nil
+	}
+	info, ok := fsys.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	f := &mergeFile{fsys: fsys, info: info}
+	if info.idx.Checksum != "" && info.idx.ChecksumType.IsSet() {
+		f.hasher = info.idx.ChecksumType.Hasher()
+	}
+	return f, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (fsys *MergeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, ok := fsys.dirs[name]
+	if !ok {
+		if _, ok = fsys.files[name]; ok {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+// Stat returns the fs.FileInfo of the named file or directory.
+func (fsys *MergeFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := fsys.dirs[name]; ok {
+		return fsys.dirInfo(name), nil
+	}
+	if info, ok := fsys.files[name]; ok {
+		return info, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (fsys *MergeFS) dirInfo(name string) *mergeFileInfo {
+	return &mergeFileInfo{name: path.Base(name), dir: true}
+}
+
+// openRange opens [off, end) of the entry with a ranged GET of the data
+// object pinned to the version the index describes.
+func (fsys *MergeFS) openRange(idx *ObjectIndex, off, end int64) (io.ReadCloser, error) {
+	opts := fsys.getOpts.clone()
+	if err := opts.SetRange(idx.Offset+off, idx.Offset+end-1); err != nil {
+		return nil, err
+	}
+	if fsys.meta.DataETag != "" {
+		opts.SetMatchETag(fsys.meta.DataETag)
+	}
+	opts.VersionID = fsys.meta.DataVersionID
+
+	reader, _, _, err := fsys.client.getObject(fsys.ctx, fsys.bucketName, fsys.meta.dataObjectName(fsys.id), opts)
+	return reader, err
+}
+
+// mergeFileInfo is the fs.FileInfo and fs.DirEntry of a merge pack file
+// or directory.
+type mergeFileInfo struct {
+	name  string
+	entry string // name of the entry in the index
+	idx   *ObjectIndex
+	dir   bool
+}
+
+func (i *mergeFileInfo) Name() string { return i.name }
+
+func (i *mergeFileInfo) Size() int64 {
+	if i.dir {
+		return 0
+	}
+	return i.idx.Size
+}
+
+func (i *mergeFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (i *mergeFileInfo) ModTime() time.Time {
+	if i.dir || i.idx.ModTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, i.idx.ModTime)
+}
+
+func (i *mergeFileInfo) IsDir() bool { return i.dir }
+
+// Sys returns the *ObjectIndex of a file, nil for a directory.
+func (i *mergeFileInfo) Sys() interface{} {
+	if i.dir {
+		return nil
+	}
+	return i.idx
+}
+
+func (i *mergeFileInfo) Type() fs.FileMode { return i.Mode().Type() }
+
+func (i *mergeFileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// mergeDir is an opened directory of a MergeFS.
+type mergeDir struct {
+	info    *mergeFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *mergeDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *mergeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *mergeDir) Close() error { return nil }
+
+func (d *mergeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := len(d.entries) - d.offset
+	if n > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > remaining {
+		n = remaining
+	}
+	entries := append([]fs.DirEntry(nil), d.entries[d.offset:d.offset+n]...)
+	d.offset += n
+	return entries, nil
+}
+
+// mergeFile is an opened entry of a MergeFS. Sequential reads share one
+// ranged GET, ReadAt and reads after a Seek open a new one. The checksum
+// of the entry is verified when it is read sequentially from the start,
+// a Seek to another position turns the verification off.
+type mergeFile struct {
+	fsys *MergeFS
+	info *mergeFileInfo
+
+	pos     int64
+	body    io.ReadCloser
+	bodyPos int64
+	hasher  hash.Hash
+	closed  bool
+}
+
+func (f *mergeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *mergeFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	size := f.info.idx.Size
+	if f.pos >= size {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if f.body == nil || f.bodyPos != f.pos {
+		f.closeBody()
+		body, err := f.fsys.openRange(f.info.idx, f.pos, size)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+		f.bodyPos = f.pos
+	}
+
+	if remaining := size - f.pos; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := f.body.Read(b)
+	f.pos += int64(n)
+	f.bodyPos = f.pos
+	if err == io.EOF {
+		if f.pos < size {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if f.hasher != nil {
+		f.hasher.Write(b[:n])
+		if f.pos == size {
+			actual := NewChecksum(f.info.idx.ChecksumType, f.hasher.Sum(nil)).Encoded()
+			f.hasher = nil
+			if actual != f.info.idx.Checksum {
+				return n, MergeChecksumError{
+					ObjectName: f.info.entry,
+					Type:       f.info.idx.ChecksumType,
+					Expected:   f.info.idx.Checksum,
+					Actual:     actual,
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+func (f *mergeFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.info.name, Err: errors.New("negative offset")}
+	}
+	size := f.info.idx.Size
+	if off >= size {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(b))
+	if end > size {
+		end = size
+	}
+	body, err := f.fsys.openRange(f.info.idx, off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, b[:end-off])
+	if err != nil {
+		return n, err
+	}
+	if end-off < int64(len(b)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *mergeFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.idx.Size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: errors.New("negative position")}
+	}
+	if offset != f.pos {
+		f.hasher = nil
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *mergeFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	f.closeBody()
+	return nil
+}
+
+func (f *mergeFile) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
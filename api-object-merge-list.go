@@ -0,0 +1,144 @@
+package ossClient
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ListMergePacksOptions filters the merge packs returned by ListMergePacks.
+type ListMergePacksOptions struct {
+	// Only list packs whose VacancySize/TotalSize is at least MinVacancyRatio.
+	MinVacancyRatio float64
+	// Only list packs whose index was modified at least MinAge ago.
+	MinAge time.Duration
+	// Only list packs whose index was modified at most MaxAge ago, 0 disables it.
+	MaxAge time.Duration
+	// Include the tags of every pack, costs one request per pack.
+	WithTags bool
+}
+
+// MergePackInfo describes one merge pack found by ListMergePacks.
+type MergePackInfo struct {
+	ID           string
+	ObjectNum    int // entries recorded in the index, including invalid ones
+	ValidNum     int // entries still readable
+	TotalSize    int64
+	VacancySize  int64
+	LastModified time.Time // last modification of the index
+	Tags         map[string]string
+
+	// Error of the listing, no other field is set, or the error reading
+	// the index of the pack ID, only ID and LastModified are set then.
+	Err error
+}
+
+// VacancyRatio returns VacancySize/TotalSize of the pack.
+func (m MergePackInfo) VacancyRatio() float64 {
+	if m.TotalSize == 0 {
+		return 0
+	}
+	return float64(m.VacancySize) / float64(m.TotalSize)
+}
+
+// ListMergePacks walks the merge indexes of the bucket and sends every
+// pack passing the filters of opts to the returned channel, the channel
+// is closed when the listing is done or ctx is canceled. A pack whose
+// index can not be read is sent with its error and the listing goes on,
+// a failed listing is sent as an error without ID and ends it.
+//
+//	for pack := range api.ListMergePacks(ctx, "mybucket", ListMergePacksOptions{MinVacancyRatio: 0.5}) {
+//	    if pack.Err != nil && pack.ID == "" {
+//	        return pack.Err
+//	    }
+//	    if pack.Err != nil {
+//	        log.Println(pack.ID, pack.Err)
+//	        continue
+//	    }
+//	    fmt.Println(pack.ID, pack.VacancyRatio())
+//	}
+func (c *Client) ListMergePacks(ctx context.Context, bucketName string, opts ListMergePacksOptions) <-chan MergePackInfo {
+	packCh := make(chan MergePackInfo, 1)
+
+	go func() {
+		defer close(packCh)
+
+		send := func(info MergePackInfo) bool {
+			select {
+			case packCh <- info:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		listOpts := ListObjectsOptions{
+			Prefix:    MergeDir + IdxPrefix,
+			Recursive: true,
+		}
+		for object := range c.ListObjects(ctx, bucketName, listOpts) {
+			if object.Err != nil {
+				send(MergePackInfo{Err: object.Err})
+				return
+			}
+
+			age := time.Since(object.LastModified)
+			if age < opts.MinAge || (opts.MaxAge > 0 && age > opts.MaxAge) {
+				continue
+			}
+
+			id := strings.TrimPrefix(object.Key, MergeDir+IdxPrefix)
+			info, err := c.mergePackInfo(ctx, bucketName, id, opts.WithTags)
+			if err != nil {
+				// The pack was removed after it was listed.
+				if ToErrorResponse(err).Code == "NoSuchKey" {
+					continue
+				}
+				if !send(MergePackInfo{ID: id, LastModified: object.LastModified, Err: err}) {
+					return
+				}
+				continue
+			}
+			if info.VacancyRatio() < opts.MinVacancyRatio {
+				continue
+			}
+			info.LastModified = object.LastModified
+
+			if !send(info) {
+				return
+			}
+		}
+	}()
+
+	return packCh
+}
+
+// mergePackInfo summarizes the index of a merge pack.
+func (c *Client) mergePackInfo(ctx context.Context, bucketName, id string, withTags bool) (MergePackInfo, error) {
+	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return MergePackInfo{}, err
+	}
+
+	info := MergePackInfo{
+		ID:          id,
+		ObjectNum:   meta.ObjectNum,
+		TotalSize:   meta.TotalSize,
+		VacancySize: meta.VacancySize,
+	}
+	for _, idx := range meta.Info {
+		if idx.Valid {
+			info.ValidNum++
+		}
+	}
+
+	if withTags {
+		t, err := c.GetObjectTagging(ctx, bucketName, meta.dataObjectName(id), GetObjectTaggingOptions{})
+		if err != nil {
+			return MergePackInfo{}, err
+		}
+		info.Tags = t.ToMap()
+	}
+
+	return info, nil
+}
@@ -0,0 +1,114 @@
+package ossClient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+// MergePackOptions are the storage options of a merge pack, applied to the
+// index and to the data object whenever they are written.
+//
+// An SSE-C key only encrypts the data object and is never stored: the index
+// stays readable by DeleteObjectWithId, ListMergePacks and CheckMergePacks,
+// and the key has to be passed again to OpenMergePackWithOptions,
+// CompactMergePack and to the reads of the pack. SSE-S3 and SSE-KMS are
+// recorded in the index and reapplied when the pack is rewritten.
+type MergePackOptions struct {
+	ServerSideEncryption encrypt.ServerSide
+	StorageClass         string
+	Mode                 RetentionMode
+	RetainUntilDate      time.Time
+	LegalHold            LegalHoldStatus
+	PreferredEnginePool  ErasurePoolEngine
+}
+
+// MergePackStorage is the part of MergePackOptions recorded in the index,
+// it never holds key material.
+type MergePackStorage struct {
+	StorageClass    string            `json:"storageClass,omitempty"`
+	Mode            RetentionMode     `json:"mode,omitempty"`
+	RetainUntilDate time.Time         `json:"retainUntilDate"`
+	LegalHold       LegalHoldStatus   `json:"legalHold,omitempty"`
+	EnginePool      ErasurePoolEngine `json:"enginePool,omitempty"`
+	Encryption      encrypt.Type      `json:"encryption,omitempty"`
+	KMSKeyID        string            `json:"kmsKeyID,omitempty"`
+	KMSContext      string            `json:"kmsContext,omitempty"` // base64 JSON as sent to the server
+}
+
+// newMergePackStorage returns what is recorded of opts, nil when opts
+// are all defaults.
+func newMergePackStorage(opts MergePackOptions) *MergePackStorage {
+	stored := &MergePackStorage{
+		StorageClass:    opts.StorageClass,
+		Mode:            opts.Mode,
+		RetainUntilDate: opts.RetainUntilDate,
+		LegalHold:       opts.LegalHold,
+		EnginePool:      opts.PreferredEnginePool,
+	}
+	if sse := opts.ServerSideEncryption; sse != nil && sse.Type() != encrypt.SSEC {
+		h := make(http.Header)
+		sse.Marshal(h)
+		stored.Encryption = sse.Type()
+		stored.KMSKeyID = h.Get(encrypt.SseKmsKeyID)
+		stored.KMSContext = h.Get(encrypt.SseEncryptionContext)
+	}
+	if *stored == (MergePackStorage{}) {
+		return nil
+	}
+	return stored
+}
+
+// serverSide rebuilds the recorded SSE-S3 or SSE-KMS encryption.
+func (o *MergePackStorage) serverSide() (encrypt.ServerSide, error) {
+	switch o.Encryption {
+	case encrypt.S3:
+		return encrypt.NewSSE(), nil
+	case encrypt.KMS:
+		if o.KMSContext == "" {
+			return encrypt.NewSSEKMS(o.KMSKeyID, nil)
+		}
+		context, err := base64.StdEncoding.DecodeString(o.KMSContext)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEKMS(o.KMSKeyID, json.RawMessage(context))
+	}
+	return nil, nil
+}
+
+// apply sets the recorded options on opts.
+func (o *MergePackStorage) apply(opts *PutObjectOptions) error {
+	if o == nil {
+		return nil
+	}
+	sse, err := o.serverSide()
+	if err != nil {
+		return err
+	}
+	if sse != nil {
+		opts.ServerSideEncryption = sse
+	}
+	opts.StorageClass = o.StorageClass
+	opts.Mode = o.Mode
+	opts.RetainUntilDate = o.RetainUntilDate
+	opts.LegalHold = o.LegalHold
+	opts.PreferredEnginePool = o.EnginePool
+	return nil
+}
+
+// mergeDataPutOptions returns the options of a write of the data object,
+// ssec is the SSE-C key of the pack if any.
+func mergeDataPutOptions(meta *ObjectIndexInfo, ssec encrypt.ServerSide) (PutObjectOptions, error) {
+	opts := PutObjectOptions{}
+	if err := meta.Storage.apply(&opts); err != nil {
+		return PutObjectOptions{}, err
+	}
+	if ssec = encrypt.SSE(ssec); ssec != nil {
+		opts.ServerSideEncryption = ssec
+	}
+	return opts, nil
+}
@@ -0,0 +1,304 @@
+package ossClient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+const (
+	// defaultMergeMemoryLimit - bytes of a merge pack kept in memory before
+	// it is spilled to a temporary file.
+	defaultMergeMemoryLimit = 1024 * 1024 * 64
+)
+
+var errMergeUploadBroken = errors.New("merge upload is broken by a previous failure, please abort it")
+
+// mergeDataWriter buffers the data object of a merge pack while entries
+// are added and commits it in CompleteMergePartUpload.
+type mergeDataWriter interface {
+	io.Writer
+	// truncate rolls the data back to size bytes after a failed entry.
+	truncate(size int64) error
+	// maxSize is the largest data object the writer can produce.
+	maxSize() int64
+	commit(ctx context.Context, c *Client, bucketName, objectName string, size int64, opts PutObjectOptions) (UploadInfo, error)
+	// release frees the buffered data and aborts anything left uncommitted.
+	release(ctx context.Context) error
+}
+
+// newMergeDataWriter picks the data writer configured by opts, putOpts
+// are the options of the data object.
+func newMergeDataWriter(c *Client, bucketName, objectName string, opts MergeUploadOptions, putOpts PutObjectOptions) (mergeDataWriter, error) {
+	if opts.StreamParts {
+		return newMergePartStream(c, bucketName, objectName, opts.PartSize, putOpts)
+	}
+	return newMergeSpool(opts.SpillDir, opts.MemoryLimit), nil
+}
+
+// mergeSpool keeps the data in memory until memLimit is exceeded and then
+// moves it to a temporary file, the file is uploaded with a known size so
+// PutObject switches to a parallel multipart upload for large packs.
+type mergeSpool struct {
+	dir      string
+	memLimit int64
+	mem      []byte
+	file     *os.File
+	size     int64
+}
+
+func newMergeSpool(dir string, memLimit int64) *mergeSpool {
+	if memLimit <= 0 {
+		memLimit = defaultMergeMemoryLimit
+	}
+	return &mergeSpool{
+		dir:      dir,
+		memLimit: memLimit,
+	}
+}
+
+func (s *mergeSpool) Write(p []byte) (int, error) {
+	if s.file == nil && int64(len(s.mem)+len(p)) > s.memLimit {
+		f, err := os.CreateTemp(s.dir, "merge-pack-*")
+		if err != nil {
+			return 0, err
+		}
+		if _, err = f.Write(s.mem); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, err
+		}
+		s.file = f
+		s.mem = nil
+	}
+
+	if s.file != nil {
+		n, err := s.file.Write(p)
+		s.size += int64(n)
+		return n, err
+	}
+
+	s.mem = append(s.mem, p...)
+	s.size += int64(len(p))
+	return len(p), nil
+}
+
+func (s *mergeSpool) truncate(size int64) error {
+	if size > s.size {
+		return errors.New("truncate size is larger than the spooled data")
+	}
+	if s.file == nil {
+		s.mem = s.mem[:size]
+		s.size = size
+		return nil
+	}
+	if err := s.file.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+func (s *mergeSpool) maxSize() int64 {
+	return maxMultipartPutObjectSize
+}
+
+func (s *mergeSpool) reader() io.Reader {
+	if s.file != nil {
+		return io.NewSectionReader(s.file, 0, s.size)
+	}
+	return bytes.NewReader(s.mem)
+}
+
+func (s *mergeSpool) commit(ctx context.Context, c *Client, bucketName, objectName string, size int64, opts PutObjectOptions) (UploadInfo, error) {
+	return c.PutObject(ctx, bucketName, objectName, s.reader(), size, opts)
+}
+
+// appendTo appends the spooled data to an existing object with
+// AppendObjectWithOptions calls smaller than the single PUT limit. The
+// object must have size bytes and the ETag etag, every call is pinned to
+// the size and ETag left by the previous one, so a write by anybody else
+// fails with ErrAppendPositionMismatch instead of interleaving. ssec is the
+// SSE-C key of the object if any.
+func (s *mergeSpool) appendTo(ctx context.Context, c *Client, bucketName, objectName string, size int64, etag string,
+	ssec encrypt.ServerSide,
+) (UploadInfo, error) {
+	var info UploadInfo
+	reader := s.reader()
+	for remaining := s.size; remaining > 0; {
+		n := remaining
+		if n >= maxPartSize {
+			n = maxPartSize - 1
+		}
+		opts := AppendObjectOptions{ServerSideEncryption: ssec}
+		if err := opts.SetExpectedSize(size); err != nil {
+			return UploadInfo{}, err
+		}
+		if etag != "" {
+			opts.SetMatchETag(etag)
+		}
+		var err error
+		info, err = c.AppendObjectWithOptions(ctx, bucketName, objectName, io.LimitReader(reader, n), n, opts)
+		if err != nil {
+			return UploadInfo{}, err
+		}
+		size, etag = size+n, info.ETag
+		remaining -= n
+	}
+	return info, nil
+}
+
+func (s *mergeSpool) release(_ context.Context) error {
+	s.mem = nil
+	s.size = 0
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	s.file.Close()
+	s.file = nil
+	return os.Remove(name)
+}
+
+// mergePartStream uploads the data object as a multipart upload while the
+// entries are added, only the current part is held in memory.
+type mergePartStream struct {
+	client     *Client
+	bucketName string
+	objectName string
+	opts       PutObjectOptions
+	partSize   int
+	uploader   *MultipartUploader
+	buf        []byte
+	flushed    int64
+	partNumber int
+	broken     bool
+}
+
+func newMergePartStream(c *Client, bucketName, objectName string, partSize uint64, opts PutObjectOptions) (*mergePartStream, error) {
+	if partSize == 0 {
+		partSize = minPartSize
+	}
+	if partSize < absMinPartSize {
+		return nil, errInvalidArgument("Input part size is smaller than allowed minimum of 5MiB.")
+	}
+	if partSize > maxPartSize {
+		return nil, errInvalidArgument("Input part size is bigger than allowed maximum of 5GiB.")
+	}
+
+	opts.PartSize = partSize
+	return &mergePartStream{
+		client:     c,
+		bucketName: bucketName,
+		objectName: objectName,
+		opts:       opts,
+		partSize:   int(partSize),
+		buf:        make([]byte, 0, partSize),
+		partNumber: 1,
+	}, nil
+}
+
+func (s *mergePartStream) Write(p []byte) (int, error) {
+	if s.broken {
+		return 0, errMergeUploadBroken
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := s.partSize - len(s.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		s.buf = append(s.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(s.buf) == s.partSize {
+			if err := s.flush(context.Background()); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// flush uploads the buffered bytes as the next part.
+func (s *mergePartStream) flush(ctx context.Context) error {
+	if s.uploader == nil {
+		uploader, err := s.client.NewUploadID(ctx, s.bucketName, s.objectName, &s.opts)
+		if err != nil {
+			s.broken = true
+			return err
+		}
+		s.uploader = uploader
+	}
+
+	if err := s.uploader.uploadPart(ctx, s.buf, len(s.buf), s.partNumber); err != nil {
+		s.broken = true
+		return err
+	}
+	s.flushed += int64(len(s.buf))
+	s.partNumber++
+	s.buf = s.buf[:0]
+
+	return nil
+}
+
+func (s *mergePartStream) truncate(size int64) error {
+	if size < s.flushed {
+		s.broken = true
+		return errMergeUploadBroken
+	}
+	if size > s.flushed+int64(len(s.buf)) {
+		return errors.New("truncate size is larger than the streamed data")
+	}
+	s.buf = s.buf[:size-s.flushed]
+	return nil
+}
+
+func (s *mergePartStream) maxSize() int64 {
+	size := int64(s.partSize) * maxPartsCount
+	if size > maxMultipartPutObjectSize {
+		size = maxMultipartPutObjectSize
+	}
+	return size
+}
+
+func (s *mergePartStream) commit(ctx context.Context, c *Client, bucketName, objectName string, size int64, opts PutObjectOptions) (UploadInfo, error) {
+	if s.broken {
+		return UploadInfo{}, errMergeUploadBroken
+	}
+
+	// Nothing was flushed yet, a single PUT is enough.
+	if s.uploader == nil {
+		return c.PutObject(ctx, bucketName, objectName, bytes.NewReader(s.buf), size, opts)
+	}
+
+	if len(s.buf) > 0 {
+		if err := s.flush(ctx); err != nil {
+			return UploadInfo{}, err
+		}
+	}
+	s.uploader.eof = true
+	info, err := s.uploader.CompleteMultipartUpload(ctx)
+	if err != nil {
+		s.broken = true
+	}
+	return info, err
+}
+
+func (s *mergePartStream) release(ctx context.Context) error {
+	s.buf = nil
+	if s.uploader == nil || s.uploader.completed {
+		return nil
+	}
+	return s.uploader.AbortMultipartUpload(ctx)
+}
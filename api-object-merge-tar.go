@@ -0,0 +1,222 @@
+package ossClient
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
+)
+
+// PAX records holding the metadata of an entry in the archives of
+// ExportMergePack and ImportMergePack.
+const (
+	mergePAXPrefix       = "TRINET.merge."
+	mergePAXContentType  = mergePAXPrefix + "contentType"
+	mergePAXChecksumType = mergePAXPrefix + "checksumType"
+	mergePAXChecksum     = mergePAXPrefix + "checksum"
+	mergePAXMetaPrefix   = mergePAXPrefix + "meta."
+)
+
+// ExportMergePackOptions configures ExportMergePackWithOptions.
+type ExportMergePackOptions struct {
+	// SSE-C key of the data object of the pack.
+	Encryption encrypt.ServerSide
+}
+
+// ExportMergePack writes the valid entries of the merge pack id to w as a
+// tar archive, in the order they are stored. Content type, user metadata
+// and checksum of an entry are kept in PAX records, the modification time
+// in the tar header. The data object is streamed with a single GET and
+// checksums recorded in the index are verified on the way.
+func (c *Client) ExportMergePack(ctx context.Context, bucketName, id string, w io.Writer) error {
+	return c.ExportMergePackWithOptions(ctx, bucketName, id, w, ExportMergePackOptions{})
+}
+
+// ExportMergePackWithOptions is ExportMergePack for a pack encrypted with
+// the SSE-C key of opts.
+func (c *Client) ExportMergePackWithOptions(ctx context.Context, bucketName, id string, w io.Writer, opts ExportMergePackOptions) error {
+	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(meta.Info))
+	for name, idx := range meta.Info {
+		if idx.Valid {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return meta.Info[names[i]].Offset < meta.Info[names[j]].Offset
+	})
+
+	tw := tar.NewWriter(w)
+	if len(names) > 0 {
+		getOpts := GetObjectOptions{ServerSideEncryption: encrypt.SSE(opts.Encryption)}
+		if meta.DataETag != "" {
+			getOpts.SetMatchETag(meta.DataETag)
+		}
+		getOpts.VersionID = meta.DataVersionID
+		src, _, _, err := c.getObject(ctx, bucketName, meta.dataObjectName(id), getOpts)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		var pos int64
+		for _, name := range names {
+			idx := meta.Info[name]
+			if idx.Offset < pos {
+				return fmt.Errorf("merge index %s has overlapping entry %s", id, name)
+			}
+			if _, err = io.CopyN(io.Discard, src, idx.Offset-pos); err != nil {
+				return err
+			}
+			if err = exportMergeEntry(tw, name, idx, src); err != nil {
+				return err
+			}
+			pos = idx.Offset + idx.Size
+		}
+	}
+
+	return tw.Close()
+}
+
+// exportMergeEntry writes one entry read from src to tw.
+func exportMergeEntry(tw *tar.Writer, name string, idx *ObjectIndex, src io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     idx.Size,
+		Mode:     0o644,
+	}
+	if idx.ModTime != 0 {
+		hdr.ModTime = time.Unix(0, idx.ModTime)
+	}
+	records := make(map[string]string)
+	if idx.ContentType != "" {
+		records[mergePAXContentType] = idx.ContentType
+	}
+	for k, v := range idx.UserMetadata {
+		records[mergePAXMetaPrefix+k] = v
+	}
+	if idx.Checksum != "" && idx.ChecksumType.IsSet() {
+		records[mergePAXChecksumType] = idx.ChecksumType.String()
+		records[mergePAXChecksum] = idx.Checksum
+	}
+	if len(records) > 0 {
+		hdr.PAXRecords = records
+		hdr.Format = tar.FormatPAX
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	var w io.Writer = tw
+	hasher := idx.ChecksumType.Hasher()
+	if idx.Checksum == "" {
+		hasher = nil
+	}
+	if hasher != nil {
+		w = io.MultiWriter(tw, hasher)
+	}
+	if _, err := io.CopyN(w, src, idx.Size); err != nil {
+		return err
+	}
+	if hasher != nil {
+		if actual := NewChecksum(idx.ChecksumType, hasher.Sum(nil)).Encoded(); actual != idx.Checksum {
+			return MergeChecksumError{ObjectName: name, Type: idx.ChecksumType, Expected: idx.Checksum, Actual: actual}
+		}
+	}
+	return nil
+}
+
+// ImportMergePack builds a new merge pack from the regular files of the
+// tar archive read from r and returns its ID. The metadata written by
+// ExportMergePack is restored and archived checksums are verified. Empty
+// files are skipped since a merge pack can not hold empty entries, other
+// file types are ignored.
+func (c *Client) ImportMergePack(ctx context.Context, bucketName string, r io.Reader) (string, error) {
+	return c.ImportMergePackWithOptions(ctx, "", bucketName, r, MergeUploadOptions{})
+}
+
+// ImportMergePackWithOptions is ImportMergePack with the ID and the
+// options of InitMergePartUploadWithOptions, the archive is spilled to
+// disk or streamed as parts as configured by opts.
+func (c *Client) ImportMergePackWithOptions(ctx context.Context, id, bucketName string, r io.Reader, opts MergeUploadOptions) (string, error) {
+	p, err := c.InitMergePartUploadWithOptions(id, bucketName, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err = importMergeEntries(ctx, p, tar.NewReader(r)); err != nil {
+		p.AbortMergePartUpload(ctx)
+		return "", err
+	}
+	if err = p.CompleteMergePartUpload(ctx); err != nil {
+		return "", err
+	}
+	return p.ID, nil
+}
+
+// importMergeEntries adds the regular files of tr to p until ctx is done.
+func importMergeEntries(ctx context.Context, p *PutObjectMerge, tr *tar.Reader) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size == 0 {
+			continue
+		}
+
+		partOpts := MergePartOptions{
+			ContentType: hdr.PAXRecords[mergePAXContentType],
+			ModTime:     hdr.ModTime,
+		}
+		for k, v := range hdr.PAXRecords {
+			if strings.HasPrefix(k, mergePAXMetaPrefix) {
+				if partOpts.UserMetadata == nil {
+					partOpts.UserMetadata = make(map[string]string)
+				}
+				partOpts.UserMetadata[strings.TrimPrefix(k, mergePAXMetaPrefix)] = v
+			}
+		}
+		expected := hdr.PAXRecords[mergePAXChecksum]
+		if expected != "" {
+			partOpts.Checksum = parseMergeChecksumType(hdr.PAXRecords[mergePAXChecksumType])
+			if !partOpts.Checksum.IsSet() {
+				return fmt.Errorf("unknown checksum type %q of %s", hdr.PAXRecords[mergePAXChecksumType], hdr.Name)
+			}
+		}
+
+		meta, err := p.UploadMergePartWithOptions(hdr.Name, tr, partOpts)
+		if err != nil {
+			return err
+		}
+		if idx := meta.Info[hdr.Name]; expected != "" && idx.Checksum != expected {
+			return MergeChecksumError{ObjectName: hdr.Name, Type: idx.ChecksumType, Expected: expected, Actual: idx.Checksum}
+		}
+	}
+}
+
+// parseMergeChecksumType returns the checksum type named s by String.
+func parseMergeChecksumType(s string) ChecksumType {
+	for t := ChecksumSHA256; t < checksumLast; t <<= 1 {
+		if t.String() == s {
+			return t
+		}
+	}
+	return ChecksumNone
+}
@@ -3,12 +3,16 @@ package ossClient
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
 	"github.com/trinet2005/oss-go-sdk/pkg/tags"
 	uuid2 "github.com/google/uuid"
 	"io"
+	"math"
+	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,12 +20,49 @@ const (
 	MergeDir   = ".internal.merge.objects/"
 	IdxPrefix  = ".idx."
 	DataPrefix = ".data."
+
+	// GenerationPrefix names the data objects written by CompactMergePack,
+	// the index refers to the one in use by ObjectIndexInfo.DataObject.
+	GenerationPrefix = ".gen."
+
+	// defaultMergeIndexAttempts - attempts of an index update against
+	// concurrent writers.
+	defaultMergeIndexAttempts = 5
 )
 
 type ObjectIndex struct {
 	Valid  bool  `json:"valid"`
 	Offset int64 `json:"offset"`
 	Size   int64 `json:"size"`
+
+	// Optional per-entry metadata, see UploadMergePartWithOptions.
+	ContentType  string            `json:"contentType,omitempty"`
+	ModTime      int64             `json:"modTime,omitempty"` // unix nanoseconds
+	UserMetadata map[string]string `json:"userMetadata,omitempty"`
+	ChecksumType ChecksumType      `json:"checksumType,omitempty"`
+	Checksum     string            `json:"checksum,omitempty"` // base64 encoded
+}
+
+// MergePartOptions holds the optional metadata stored in the index for
+// an entry of a merge pack.
+type MergePartOptions struct {
+	ContentType  string
+	ModTime      time.Time
+	UserMetadata map[string]string
+	Checksum     ChecksumType // checksum computed while the entry is added and verified on read
+}
+
+// MergeChecksumError is returned while reading an entry whose data does
+// not match the checksum recorded in the index.
+type MergeChecksumError struct {
+	ObjectName string
+	Type       ChecksumType
+	Expected   string
+	Actual     string
+}
+
+func (e MergeChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch for %s, expected %s got %s", e.Type, e.ObjectName, e.Expected, e.Actual)
 }
 
 type ObjectIndexInfo struct {
@@ -29,6 +70,53 @@ type ObjectIndexInfo struct {
 	TotalSize   int64                   `json:"totalSize"`
 	ObjectNum   int                     `json:"objectNum"`
 	Info        map[string]*ObjectIndex `json:"objInfo"`
+
+	// DataETag is the ETag of the data object the index was committed
+	// against. The data object is always written before the index, reads
+	// are pinned to this ETag so a reader never gets bytes of another
+	// generation of the data object.
+	DataETag string `json:"dataETag,omitempty"`
+	// DataVersionID is the version of the data object the index was
+	// committed against on a versioned bucket. Reads are pinned to it, so
+	// a reader holding an older index keeps reading the retained version
+	// the index describes after the pack was appended to or compacted.
+	DataVersionID string `json:"dataVersionID,omitempty"`
+	// DataObject is the name below MergeDir of the data object the index
+	// refers to, empty for the DataPrefix object the pack was created with.
+	// A compaction writes a new data object and switches the index to it.
+	DataObject string `json:"dataObject,omitempty"`
+
+	// Storage options the pack was created with, reapplied whenever the
+	// index or the data object is rewritten.
+	Storage *MergePackStorage `json:"storage,omitempty"`
+
+	// Format the index is written in, read from the stored index and kept
+	// when the index is rewritten.
+	Format MergeIndexFormat `json:"-"`
+}
+
+// dataObjectName returns the name of the data object the index refers to.
+func (m *ObjectIndexInfo) dataObjectName(id string) string {
+	if m.DataObject == "" {
+		return MergeDir + DataPrefix + id
+	}
+	return MergeDir + m.DataObject
+}
+
+// MergeUploadOptions configures how the data object of a merge pack is
+// buffered until CompleteMergePartUpload.
+type MergeUploadOptions struct {
+	MemoryLimit int64  // bytes kept in memory before spilling to a temporary file, default 64MiB
+	SpillDir    string // directory of the temporary file, default os.TempDir()
+	StreamParts bool   // upload the data object part by part while entries are added instead of spilling to disk
+	PartSize    uint64 // part size used by StreamParts, default 16MiB, the pack is limited to PartSize*10000
+
+	IndexFormat MergeIndexFormat // encoding of the index of a new pack, default MergeIndexJSON
+
+	// Encryption, storage class, retention and engine pool of the index and
+	// the data object. A reopened pack keeps the options it was created
+	// with, only the SSE-C key is taken from here.
+	Pack MergePackOptions
 }
 
 type PutObjectMerge struct {
@@ -36,130 +124,353 @@ type PutObjectMerge struct {
 	bucketName string
 	client     *Client
 	meta       *ObjectIndexInfo
-	reader     *PutObjectMergeReader
+	data       mergeDataWriter
+	err        error              // set when the buffered data can no longer be rolled back
+	ssec       encrypt.ServerSide // SSE-C key of the data object
+
+	// Set by OpenMergePack, new entries are appended to the existing data object.
+	base      int64               // size of the data object when the pack was opened
+	indexETag string              // ETag of the index when the pack was opened
+	added     map[string]struct{} // entries added since the pack was opened
 }
 
-type PutObjectMergeReader struct {
-	data [][]byte
-	i, j int64
+// checkBucket fails early on a missing bucket or missing permissions,
+// merge packs work on versioned and unversioned buckets alike.
+func checkBucket(c *Client, bucketName string) error {
+	_, err := c.GetBucketVersioning(context.Background(), bucketName)
+	return err
 }
 
-func (r *PutObjectMergeReader) Read(buf []byte) (int, error) {
-	if r.i >= int64(len(r.data)) {
-		return 0, io.EOF
-	}
+func (c *Client) InitMergePartUpload(id, bucketName string) (*PutObjectMerge, error) {
+	return c.InitMergePartUploadWithOptions(id, bucketName, MergeUploadOptions{})
+}
 
-	if r.j >= int64(len(r.data[r.i])) {
-		r.i++
-		r.j = 0
-		return 0, nil
+// InitMergePartUploadWithOptions starts a merge pack whose data object is
+// spilled to disk or streamed as multipart parts, so the pack is not
+// limited by memory or by the single PUT size.
+func (c *Client) InitMergePartUploadWithOptions(id, bucketName string, opts MergeUploadOptions) (*PutObjectMerge, error) {
+	err := checkBucket(c, bucketName)
+	if err != nil {
+		return nil, err
 	}
 
-	n := copy(buf, r.data[r.i][r.j:])
-	r.j += int64(n)
-	return n, nil
-}
+	if id == "" {
+		uuid, err := uuid2.NewRandom()
+		if err != nil {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s-%d", uuid.String(), time.Now().UnixNano())
+	}
 
-func checkBucket(c *Client, bucketName string) error {
-	info, err := c.GetBucketVersioning(context.Background(), bucketName)
+	meta := &ObjectIndexInfo{
+		VacancySize: 0,
+		TotalSize:   0,
+		ObjectNum:   0,
+		Info:        make(map[string]*ObjectIndex, 0),
+		Format:      opts.IndexFormat,
+		Storage:     newMergePackStorage(opts.Pack),
+	}
+	putOpts, err := mergeDataPutOptions(meta, opts.Pack.ServerSideEncryption)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if info.Enabled() {
-		return errors.New("Merge operations are not supported for buckets with versioning turned on")
+
+	data, err := newMergeDataWriter(c, bucketName, meta.dataObjectName(id), opts, putOpts)
+	if err != nil {
+		return nil, err
 	}
-	//if info.Suspended() {
-	//	return errors.New("Bucket is suspended")
-	//}
 
-	return nil
+	return &PutObjectMerge{
+		ID:         id,
+		bucketName: bucketName,
+		client:     c,
+		meta:       meta,
+		data:       data,
+		ssec:       encrypt.SSE(opts.Pack.ServerSideEncryption),
+	}, nil
 }
 
-func (c *Client) InitMergePartUpload(id, bucketName string) (*PutObjectMerge, error) {
+// OpenMergePack loads the index of an existing merge pack, entries added
+// with UploadMergePart are appended to its data object on completion.
+func (c *Client) OpenMergePack(ctx context.Context, id, bucketName string) (*PutObjectMerge, error) {
+	return c.OpenMergePackWithOptions(ctx, id, bucketName, MergeUploadOptions{})
+}
+
+// OpenMergePackWithOptions is OpenMergePack with the buffering options of
+// InitMergePartUploadWithOptions, StreamParts is not supported.
+func (c *Client) OpenMergePackWithOptions(ctx context.Context, id, bucketName string, opts MergeUploadOptions) (*PutObjectMerge, error) {
+	if opts.StreamParts {
+		return nil, errInvalidArgument("StreamParts is not supported for reopened merge packs")
+	}
+
 	err := checkBucket(c, bucketName)
 	if err != nil {
 		return nil, err
 	}
 
-	if id == "" {
-		uuid, err := uuid2.NewRandom()
-		if err != nil {
-			return nil, err
-		}
-		id = fmt.Sprintf("%s-%d", uuid.String(), time.Now().UnixNano())
+	meta, etag, err := c.getObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return nil, err
 	}
 
+	ssec := encrypt.SSE(opts.Pack.ServerSideEncryption)
+	dataInfo, err := c.StatObject(ctx, bucketName, meta.dataObjectName(id), StatObjectOptions{ServerSideEncryption: ssec})
+	if err != nil {
+		return nil, err
+	}
+	if dataInfo.Size < meta.TotalSize {
+		return nil, fmt.Errorf("merge pack %s is corrupted, data size %d is smaller than index total size %d", id, dataInfo.Size, meta.TotalSize)
+	}
+	// Bytes appended by a commit that lost its index update.
+	meta.VacancySize += dataInfo.Size - meta.TotalSize
+	meta.TotalSize = dataInfo.Size
+	meta.DataETag = dataInfo.ETag
+	meta.DataVersionID = dataInfo.VersionID
+
 	return &PutObjectMerge{
 		ID:         id,
 		bucketName: bucketName,
 		client:     c,
-		meta: &ObjectIndexInfo{
-			VacancySize: 0,
-			TotalSize:   0,
-			ObjectNum:   0,
-			Info:        make(map[string]*ObjectIndex, 0),
-		},
-		reader: &PutObjectMergeReader{
-			data: make([][]byte, 0),
-		},
+		meta:       meta,
+		data:       newMergeSpool(opts.SpillDir, opts.MemoryLimit),
+		ssec:       ssec,
+		base:       dataInfo.Size,
+		indexETag:  etag,
 	}, nil
 }
 
 func (p *PutObjectMerge) UploadMergePart(objectName string, reader io.Reader) (*ObjectIndexInfo, error) {
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, err
+	return p.UploadMergePartWithOptions(objectName, reader, MergePartOptions{})
+}
+
+// UploadMergePartWithOptions adds an entry to the pack and records the
+// metadata of opts for it in the index.
+func (p *PutObjectMerge) UploadMergePartWithOptions(objectName string, reader io.Reader, opts MergePartOptions) (*ObjectIndexInfo, error) {
+	if p.err != nil {
+		return nil, p.err
 	}
-	dataSize := int64(len(data))
-	if dataSize == 0 {
-		return nil, errors.New("no data given")
+	if opts.Checksum != ChecksumNone && !opts.Checksum.IsSet() {
+		return nil, errInvalidArgument("invalid checksum type " + opts.Checksum.String())
 	}
 
-	if p.meta.TotalSize+dataSize > maxSinglePutObjectSize {
-		return nil, errors.New("the merged file is too large, please execute CompleteMergePartUpload first")
+	var w io.Writer = p.data
+	hasher := opts.Checksum.Hasher()
+	if hasher != nil {
+		w = io.MultiWriter(p.data, hasher)
 	}
 
-	p.reader.data = append(p.reader.data, data)
-	if _, ok := p.meta.Info[objectName]; ok {
-		p.meta.VacancySize += p.meta.Info[objectName].Size
+	// Read one byte more than allowed to detect an oversized pack.
+	limit := p.data.maxSize() - p.meta.TotalSize
+	dataSize, err := io.Copy(w, io.LimitReader(reader, limit+1))
+	if err == nil && dataSize > limit {
+		err = errors.New("the merged file is too large, please execute CompleteMergePartUpload first")
+	}
+	if err == nil && dataSize == 0 {
+		err = errors.New("no data given")
+	}
+	if err != nil {
+		if terr := p.data.truncate(p.meta.TotalSize - p.base); terr != nil {
+			p.err = terr
+		}
+		return nil, err
+	}
+
+	if old, ok := p.meta.Info[objectName]; ok {
+		// Invalid entries are already accounted as vacancy.
+		if old.Valid {
+			p.meta.VacancySize += old.Size
+		}
 	} else {
 		p.meta.ObjectNum++
 	}
-	p.meta.Info[objectName] = &ObjectIndex{
-		Valid:  true,
-		Offset: p.meta.TotalSize,
-		Size:   dataSize,
+	idx := &ObjectIndex{
+		Valid:        true,
+		Offset:       p.meta.TotalSize,
+		Size:         dataSize,
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.UserMetadata,
 	}
+	if !opts.ModTime.IsZero() {
+		idx.ModTime = opts.ModTime.UnixNano()
+	}
+	if hasher != nil {
+		idx.ChecksumType = opts.Checksum
+		idx.Checksum = NewChecksum(opts.Checksum, hasher.Sum(nil)).Encoded()
+	}
+	p.meta.Info[objectName] = idx
 	p.meta.TotalSize += dataSize
+	if p.added == nil {
+		p.added = make(map[string]struct{})
+	}
+	p.added[objectName] = struct{}{}
 
 	return p.meta, nil
 }
 
 func (p *PutObjectMerge) CompleteMergePartUpload(ctx context.Context) error {
+	if p.err != nil {
+		return p.err
+	}
+
 	err := checkBucket(p.client, p.bucketName)
 	if err != nil {
 		return err
 	}
 
-	objectIndexInfo, err := json.Marshal(p.meta)
+	if p.indexETag != "" {
+		return p.completeAppend(ctx)
+	}
+
+	// The data object goes first, an index is only ever visible for
+	// committed data. A crash in between leaves a data object without
+	// index which CheckMergePacks removes.
+	putOpts, err := mergeDataPutOptions(p.meta, p.ssec)
 	if err != nil {
+		p.data.release(ctx)
 		return err
 	}
-
-	_, err = p.client.PutObject(ctx, p.bucketName, MergeDir+IdxPrefix+p.ID, bytes.NewReader(objectIndexInfo), int64(len(objectIndexInfo)), PutObjectOptions{})
+	dataInfo, err := p.data.commit(ctx, p.client, p.bucketName, p.meta.dataObjectName(p.ID), p.meta.TotalSize, putOpts)
 	if err != nil {
+		p.data.release(ctx)
 		return err
 	}
+	p.meta.DataETag = dataInfo.ETag
+	p.meta.DataVersionID = dataInfo.VersionID
 
-	_, err = p.client.PutObject(ctx, p.bucketName, MergeDir+DataPrefix+p.ID, p.reader, p.meta.TotalSize, PutObjectOptions{})
+	_, err = p.client.putObjectIndexInfo(ctx, p.ID, p.bucketName, p.meta, "", PutObjectOptions{})
 	if err != nil {
-		p.client.removeObject(ctx, p.bucketName, MergeDir+IdxPrefix+p.ID, RemoveObjectOptions{GovernanceBypass: true})
+		p.client.removeObject(ctx, p.bucketName, p.meta.dataObjectName(p.ID), RemoveObjectOptions{
+			GovernanceBypass: true,
+			VersionID:        dataInfo.VersionID,
+		})
+		p.data.release(ctx)
 		return err
 	}
 
-	return nil
+	return p.data.release(ctx)
 }
 
+// completeAppend appends the new entries to the data object of a pack
+// opened by OpenMergePack and then writes the index if nobody else changed
+// it since. When the append or the index write loses against another
+// writer, the new entries are moved onto the latest index, and the latest
+// data object unless they were already appended, and the commit is retried
+// up to the attempts of SetMergeIndexMaxAttempts. Appended bytes of a
+// commit that still loses are not referenced by the index and are
+// accounted as vacancy by the next OpenMergePack.
+func (p *PutObjectMerge) completeAppend(ctx context.Context) error {
+	defer p.data.release(ctx)
+
+	spool, ok := p.data.(*mergeSpool)
+	if !ok {
+		return errors.New("reopened merge pack must be spooled")
+	}
+
+	c := p.client
+	attempts := c.indexAttempts()
+	meta, indexETag := p.meta, p.indexETag
+	dataName, dataETag, base := p.meta.dataObjectName(p.ID), p.meta.DataETag, p.base
+	appended := spool.size == 0
+	attempt := 0
+	for range c.newRetryTimer(ctx, attempts, DefaultRetryUnit, DefaultRetryCap, MaxJitter) {
+		attempt++
+		if attempt > 1 {
+			latest, etag, err := c.getObjectIndexInfo(ctx, p.ID, p.bucketName)
+			if err != nil {
+				return err
+			}
+			if !appended {
+				// Nothing was appended yet, append to the data object as it is now.
+				dataName = latest.dataObjectName(p.ID)
+				dataInfo, err := c.StatObject(ctx, p.bucketName, dataName, StatObjectOptions{ServerSideEncryption: p.ssec})
+				if err != nil {
+					return err
+				}
+				base, dataETag = dataInfo.Size, dataInfo.ETag
+			} else if latest.dataObjectName(p.ID) != dataName || latest.TotalSize > base {
+				// The data object was replaced or appended to after the
+				// entries, they can not be added to this index.
+				return MergeIndexConflictError{ID: p.ID, Attempts: attempt}
+			}
+			if meta, err = p.rebaseAppend(latest, base); err != nil {
+				return err
+			}
+			meta.DataETag, meta.DataVersionID = p.meta.DataETag, p.meta.DataVersionID
+			indexETag = etag
+		}
+
+		if !appended {
+			dataInfo, err := spool.appendTo(ctx, c, p.bucketName, dataName, base, dataETag, p.ssec)
+			var mismatch ErrAppendPositionMismatch
+			if errors.As(err, &mismatch) || isPreconditionFailed(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			appended = true
+			meta.DataETag = dataInfo.ETag
+			meta.DataVersionID = dataInfo.VersionID
+			p.meta.DataETag, p.meta.DataVersionID = dataInfo.ETag, dataInfo.VersionID
+		}
+
+		_, err := c.putObjectIndexInfo(ctx, p.ID, p.bucketName, meta, indexETag, PutObjectOptions{})
+		if err == nil {
+			p.meta = meta
+			return nil
+		}
+		if !isPreconditionFailed(err) {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return MergeIndexConflictError{ID: p.ID, Attempts: attempt}
+}
+
+// rebaseAppend returns latest with the entries added since OpenMergePack,
+// whose data starts at offset base of the data object. The bytes of the
+// data object between the end of latest and base are accounted as vacancy.
+func (p *PutObjectMerge) rebaseAppend(latest *ObjectIndexInfo, base int64) (*ObjectIndexInfo, error) {
+	if latest.TotalSize > base {
+		return nil, fmt.Errorf("merge pack %s is corrupted, data size %d is smaller than index total size %d", p.ID, base, latest.TotalSize)
+	}
+	appendedSize := p.meta.TotalSize - p.base
+	latest.VacancySize += base - latest.TotalSize
+	latest.TotalSize = base + appendedSize
+
+	// Entries replaced during the session left their bytes behind.
+	unused := appendedSize
+	for name := range p.added {
+		idx := *p.meta.Info[name]
+		idx.Offset += base - p.base
+		if old, ok := latest.Info[name]; ok {
+			if old.Valid {
+				latest.VacancySize += old.Size
+			}
+		} else {
+			latest.ObjectNum++
+		}
+		latest.Info[name] = &idx
+		unused -= idx.Size
+	}
+	latest.VacancySize += unused
+
+	return latest, nil
+}
+
+// AbortMergePartUpload drops the buffered entries, removes the temporary
+// file and aborts the multipart upload of the data object if any.
+func (p *PutObjectMerge) AbortMergePartUpload(ctx context.Context) error {
+	return p.data.release(ctx)
+}
+
+// GetObjectWithID returns the entry of the pack along with the index it
+// was read with. The data is requested by the first Read, which fails if
+// the pack was changed after its index was read; GetMergeObjectWithID
+// requests it at once and reloads the index then.
 func (c *Client) GetObjectWithID(ctx context.Context, id, bucketName, objectName string) (*Object, *ObjectIndexInfo, error) {
 	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
 	if err != nil {
@@ -174,99 +485,396 @@ func (c *Client) GetObjectWithID(ctx context.Context, id, bucketName, objectName
 	return data, meta, nil
 }
 
+// GetMergeObjectWithID is GetObjectWithID returning a MergeObject. The
+// entry is requested before it returns, if the data object was appended
+// to or replaced since the index was read the index is read again.
+func (c *Client) GetMergeObjectWithID(ctx context.Context, id, bucketName, objectName string) (*MergeObject, *ObjectIndexInfo, error) {
+	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := c.GetMergeObjectWithIndex(ctx, id, bucketName, objectName, meta)
+	if isPreconditionFailed(err) || ToErrorResponse(err).Code == "NoSuchKey" {
+		meta, err = c.GetObjectIndexInfo(ctx, id, bucketName)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err = c.GetMergeObjectWithIndex(ctx, id, bucketName, objectName, meta)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, meta, nil
+}
+
 func (c *Client) GetObjectIndexInfo(ctx context.Context, id, bucketName string) (*ObjectIndexInfo, error) {
+	meta, _, err := c.getObjectIndexInfo(ctx, id, bucketName)
+	return meta, err
+}
+
+// getObjectIndexInfo returns the index along with the ETag of the index object.
+func (c *Client) getObjectIndexInfo(ctx context.Context, id, bucketName string) (*ObjectIndexInfo, string, error) {
 	meta := &ObjectIndexInfo{
 		Info: make(map[string]*ObjectIndex, 0),
 	}
 
-	metaData, err := c.GetObject(ctx, bucketName, MergeDir+IdxPrefix+id, GetObjectOptions{})
+	opts := GetObjectOptions{}
+	cache := c.indexCache()
+	cachedETag := ""
+	if cache != nil {
+		if etag, ok := cache.Get(bucketName, id); ok {
+			cachedETag = etag
+			opts.SetMatchETagExcept(etag)
+		}
+	}
+
+	metaData, objInfo, _, err := c.getObject(ctx, bucketName, MergeDir+IdxPrefix+id, opts)
 	if err != nil {
-		return nil, err
+		if cachedETag != "" && ToErrorResponse(err).StatusCode == http.StatusNotModified {
+			if cached, ok := cache.Hit(bucketName, id, cachedETag); ok {
+				return cached, cachedETag, nil
+			}
+			// Invalidated meanwhile, download it again.
+			return c.getObjectIndexInfoUncached(ctx, id, bucketName)
+		}
+		return nil, "", err
 	}
 	defer metaData.Close()
 
 	buf, err := io.ReadAll(metaData)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	err = json.Unmarshal(buf, meta)
+	err = decodeObjectIndexInfo(buf, meta)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return meta, nil
+	if cache != nil {
+		cache.Set(bucketName, id, objInfo.ETag, meta)
+	}
+	return meta, objInfo.ETag, nil
 }
 
-func (c *Client) GetObjectWithIndex(ctx context.Context, id, bucketName, objectName string, meta *ObjectIndexInfo) (*Object, error) {
-	if _, ok := meta.Info[objectName]; !ok {
-		return nil, errors.New("object not found")
-	} else if !meta.Info[objectName].Valid {
-		return nil, errors.New("object invalid")
+// getObjectIndexInfoUncached downloads the index bypassing the cache.
+func (c *Client) getObjectIndexInfoUncached(ctx context.Context, id, bucketName string) (*ObjectIndexInfo, string, error) {
+	if cache := c.indexCache(); cache != nil {
+		cache.Delete(bucketName, id)
 	}
+	return c.getObjectIndexInfo(ctx, id, bucketName)
+}
 
-	opts := GetObjectOptions{}
-	err := opts.SetRange(meta.Info[objectName].Offset, meta.Info[objectName].Offset+meta.Info[objectName].Size-1)
+func (c *Client) GetObjectWithIndex(ctx context.Context, id, bucketName, objectName string, meta *ObjectIndexInfo) (*Object, error) {
+	return c.GetObjectWithIndexOptions(ctx, id, bucketName, objectName, meta, GetObjectOptions{})
+}
+
+// GetObjectWithIndexOptions is GetObjectWithIndex with the options of the
+// GET of the data object, e.g. the SSE-C key of the pack. The range and
+// the ETag precondition are set from the index. When the index holds a
+// checksum for the entry, the Read reaching the end of the entry returns a
+// MergeChecksumError on mismatch, Seek and ReadAt turn the check off.
+func (c *Client) GetObjectWithIndexOptions(ctx context.Context, id, bucketName, objectName string, meta *ObjectIndexInfo, getOpts GetObjectOptions) (*Object, error) {
+	idx, opts, err := mergeEntryGetOptions(meta, objectName, getOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := c.GetObject(ctx, bucketName, MergeDir+DataPrefix+id, opts)
+	data, err := c.GetObject(ctx, bucketName, meta.dataObjectName(id), opts)
 	if err != nil {
 		return nil, err
 	}
+	if v := newMergeVerifier(objectName, idx); v != nil {
+		data.readHook = v.update
+	}
 
 	return data, nil
 }
 
+// GetMergeObjectWithIndex is GetObjectWithIndex returning a MergeObject.
+func (c *Client) GetMergeObjectWithIndex(ctx context.Context, id, bucketName, objectName string, meta *ObjectIndexInfo) (*MergeObject, error) {
+	return c.GetMergeObjectWithIndexOptions(ctx, id, bucketName, objectName, meta, GetObjectOptions{})
+}
+
+// GetMergeObjectWithIndexOptions is GetObjectWithIndexOptions returning a
+// MergeObject, the entry is requested before it returns so a failed
+// precondition or a missing data object is returned here.
+func (c *Client) GetMergeObjectWithIndexOptions(ctx context.Context, id, bucketName, objectName string, meta *ObjectIndexInfo, getOpts GetObjectOptions) (*MergeObject, error) {
+	idx, opts, err := mergeEntryGetOptions(meta, objectName, getOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	body, info, _, err := c.getObject(ctx, bucketName, meta.dataObjectName(id), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MergeObject{
+		Index:    idx,
+		body:     body,
+		info:     info,
+		verifier: newMergeVerifier(objectName, idx),
+	}, nil
+}
+
+// mergeEntryGetOptions returns the index of the entry and the options of
+// the ranged GET of its data.
+func mergeEntryGetOptions(meta *ObjectIndexInfo, objectName string, getOpts GetObjectOptions) (*ObjectIndex, GetObjectOptions, error) {
+	idx, ok := meta.Info[objectName]
+	if !ok {
+		return nil, GetObjectOptions{}, errors.New("object not found")
+	} else if !idx.Valid {
+		return nil, GetObjectOptions{}, errors.New("object invalid")
+	}
+
+	opts := getOpts.clone()
+	if err := opts.SetRange(idx.Offset, idx.Offset+idx.Size-1); err != nil {
+		return nil, GetObjectOptions{}, err
+	}
+	if meta.DataETag != "" {
+		opts.SetMatchETag(meta.DataETag)
+	}
+	opts.VersionID = meta.DataVersionID
+	return idx, opts, nil
+}
+
+// MergeObject is an entry of a merge pack opened by GetMergeObjectWithIndex.
+// When the index holds a checksum for the entry it is verified while the
+// entry is read, the last Read returns a MergeChecksumError on mismatch.
+type MergeObject struct {
+	Index *ObjectIndex
+
+	body     io.ReadCloser
+	info     ObjectInfo
+	offset   int64
+	verifier *mergeVerifier
+}
+
+// Stat returns the ObjectInfo of the ranged GET of the entry, its Size is
+// the size of the entry.
+func (o *MergeObject) Stat() (ObjectInfo, error) {
+	return o.info, nil
+}
+
+func (o *MergeObject) Read(b []byte) (int, error) {
+	n, err := o.body.Read(b)
+	if o.verifier != nil && n > 0 {
+		if verr := o.verifier.update(o.offset, b[:n]); verr != nil {
+			err = verr
+		}
+	}
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *MergeObject) Close() error {
+	return o.body.Close()
+}
+
+// mergeVerifier hashes an entry read sequentially and compares the hash
+// with the checksum of the index once the whole entry is read.
+type mergeVerifier struct {
+	name   string
+	idx    *ObjectIndex
+	hasher hash.Hash
+	offset int64 // offset in the entry of the next byte hashed
+}
+
+// newMergeVerifier returns nil if the index holds no checksum for the entry.
+func newMergeVerifier(objectName string, idx *ObjectIndex) *mergeVerifier {
+	if idx.Checksum == "" || !idx.ChecksumType.IsSet() {
+		return nil
+	}
+	return &mergeVerifier{name: objectName, idx: idx, hasher: idx.ChecksumType.Hasher()}
+}
+
+// update hashes p read at offset in the entry, data read at another offset
+// than the end of the data hashed so far turns the verification off.
+func (v *mergeVerifier) update(offset int64, p []byte) error {
+	if v.hasher == nil || len(p) == 0 {
+		return nil
+	}
+	if offset != v.offset {
+		v.hasher = nil
+		return nil
+	}
+
+	v.hasher.Write(p)
+	v.offset += int64(len(p))
+	if v.offset < v.idx.Size {
+		return nil
+	}
+
+	actual := NewChecksum(v.idx.ChecksumType, v.hasher.Sum(nil)).Encoded()
+	v.hasher = nil
+	if actual != v.idx.Checksum {
+		return MergeChecksumError{
+			ObjectName: v.name,
+			Type:       v.idx.ChecksumType,
+			Expected:   v.idx.Checksum,
+			Actual:     actual,
+		}
+	}
+	return nil
+}
+
 func (c *Client) DeleteMergeID(ctx context.Context, id, bucketName string) error {
 	err := checkBucket(c, bucketName)
 	if err != nil {
 		return err
 	}
 
-	err = c.RemoveObject(ctx, bucketName, MergeDir+DataPrefix+id, RemoveObjectOptions{})
+	dataName := MergeDir + DataPrefix + id
+	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err == nil {
+		dataName = meta.dataObjectName(id)
+	} else if ToErrorResponse(err).Code != "NoSuchKey" {
+		return err
+	}
+
+	if cache := c.indexCache(); cache != nil {
+		cache.Delete(bucketName, id)
+	}
+
+	// The index goes first so that no index is left pointing at nothing.
+	err = c.RemoveObject(ctx, bucketName, MergeDir+IdxPrefix+id, RemoveObjectOptions{})
 	if err != nil {
 		return err
 	}
 
-	return c.RemoveObject(ctx, bucketName, MergeDir+IdxPrefix+id, RemoveObjectOptions{})
+	return c.RemoveObject(ctx, bucketName, dataName, RemoveObjectOptions{})
 }
 
+// DeleteObjectWithId marks the entry invalid in the index of the pack.
+// With a compaction policy set, see SetMergeCompactionPolicy, the pack may
+// be compacted before it returns.
 func (c *Client) DeleteObjectWithId(ctx context.Context, id, bucketName, objectName string) error {
 	err := checkBucket(c, bucketName)
 	if err != nil {
 		return err
 	}
 
-	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	meta, err := c.updateObjectIndexInfo(ctx, id, bucketName, func(meta *ObjectIndexInfo) error {
+		if _, ok := meta.Info[objectName]; !ok {
+			return errors.New("object not found")
+		} else if !meta.Info[objectName].Valid {
+			return errors.New("object already invalid")
+		}
+
+		meta.Info[objectName].Valid = false
+		meta.VacancySize += meta.Info[objectName].Size
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if _, ok := meta.Info[objectName]; !ok {
-		return errors.New("object not found")
-	} else if !meta.Info[objectName].Valid {
-		return errors.New("object already invalid")
+	c.compactByPolicy(ctx, bucketName, id, meta)
+	return nil
+}
+
+// MergeIndexConflictError is returned when an index update keeps losing
+// against concurrent writers until the attempt budget runs out.
+type MergeIndexConflictError struct {
+	ID       string
+	Attempts int
+}
+
+func (e MergeIndexConflictError) Error() string {
+	return fmt.Sprintf("merge index %s was modified concurrently, gave up after %d attempts", e.ID, e.Attempts)
+}
+
+// SetMergeIndexMaxAttempts sets how many times an index update is retried
+// after losing against a concurrent writer, values below 1 restore the default.
+// It may be called while the client is in use.
+func (c *Client) SetMergeIndexMaxAttempts(attempts int) {
+	if attempts > math.MaxInt32 {
+		attempts = math.MaxInt32
+	}
+	atomic.StoreInt32(&c.mergeIndexAttempts, int32(attempts))
+}
+
+// indexAttempts returns the attempts of an index update.
+func (c *Client) indexAttempts() int {
+	attempts := int(atomic.LoadInt32(&c.mergeIndexAttempts))
+	if attempts < 1 {
+		attempts = defaultMergeIndexAttempts
 	}
+	return attempts
+}
 
-	meta.Info[objectName].Valid = false
-	meta.VacancySize += meta.Info[objectName].Size
+// isPreconditionFailed reports whether err is a failed If-Match precondition.
+func isPreconditionFailed(err error) bool {
+	return ToErrorResponse(err).Code == "PreconditionFailed"
+}
 
-	objectIndexInfo, err := json.Marshal(meta)
+// putObjectIndexInfo writes the index, only if the index object still has
+// the given ETag when etag is not empty.
+func (c *Client) putObjectIndexInfo(ctx context.Context, id, bucketName string, meta *ObjectIndexInfo, etag string, opts PutObjectOptions) (UploadInfo, error) {
+	objectIndexInfo, err := encodeObjectIndexInfo(meta)
 	if err != nil {
-		return err
+		return UploadInfo{}, err
+	}
+	if err = meta.Storage.apply(&opts); err != nil {
+		return UploadInfo{}, err
 	}
 
-	_, err = c.PutObject(ctx, bucketName, MergeDir+IdxPrefix+id, bytes.NewReader(objectIndexInfo), int64(len(objectIndexInfo)), PutObjectOptions{})
-	if err != nil {
-		return err
+	if etag != "" {
+		opts.SetMatchETag(etag)
+	}
+	if cache := c.indexCache(); cache != nil {
+		cache.Delete(bucketName, id)
 	}
+	return c.PutObject(ctx, bucketName, MergeDir+IdxPrefix+id, bytes.NewReader(objectIndexInfo), int64(len(objectIndexInfo)), opts)
+}
 
-	return nil
+// updateObjectIndexInfo applies fn to the latest index and writes it back
+// with an If-Match precondition on the ETag it was read with. The update
+// is retried from a fresh read when another writer got in between.
+func (c *Client) updateObjectIndexInfo(ctx context.Context, id, bucketName string, fn func(meta *ObjectIndexInfo) error) (*ObjectIndexInfo, error) {
+	attempts := c.indexAttempts()
+
+	for range c.newRetryTimer(ctx, attempts, DefaultRetryUnit, DefaultRetryCap, MaxJitter) {
+		meta, etag, err := c.getObjectIndexInfo(ctx, id, bucketName)
+		if err != nil {
+			return nil, err
+		}
+		if err = fn(meta); err != nil {
+			return nil, err
+		}
+
+		_, err = c.putObjectIndexInfo(ctx, id, bucketName, meta, etag, PutObjectOptions{})
+		if err == nil {
+			return meta, nil
+		}
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, MergeIndexConflictError{ID: id, Attempts: attempts}
+}
+
+// mergeDataObjectName returns the name of the current data object of the pack.
+func (c *Client) mergeDataObjectName(ctx context.Context, bucketName, id string) (string, error) {
+	meta, err := c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return "", err
+	}
+	return meta.dataObjectName(id), nil
 }
 
 func (c *Client) PutMergeObjectTagging(ctx context.Context, bucketName, id string, otags *tags.Tags, opts PutObjectTaggingOptions) error {
-	err := c.PutObjectTagging(ctx, bucketName, MergeDir+DataPrefix+id, otags, opts)
+	dataName, err := c.mergeDataObjectName(ctx, bucketName, id)
+	if err != nil {
+		return err
+	}
+	err = c.PutObjectTagging(ctx, bucketName, dataName, otags, opts)
 	if err != nil {
 		return err
 	}
@@ -275,11 +883,19 @@ func (c *Client) PutMergeObjectTagging(ctx context.Context, bucketName, id strin
 }
 
 func (c *Client) GetMergeObjectTagging(ctx context.Context, bucketName, id string, opts GetObjectTaggingOptions) (*tags.Tags, error) {
-	return c.GetObjectTagging(ctx, bucketName, MergeDir+DataPrefix+id, opts)
+	dataName, err := c.mergeDataObjectName(ctx, bucketName, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetObjectTagging(ctx, bucketName, dataName, opts)
 }
 
 func (c *Client) RemoveMergeObjectTagging(ctx context.Context, bucketName, id string, opts RemoveObjectTaggingOptions) error {
-	err := c.RemoveObjectTagging(ctx, bucketName, MergeDir+DataPrefix+id, opts)
+	dataName, err := c.mergeDataObjectName(ctx, bucketName, id)
+	if err != nil {
+		return err
+	}
+	err = c.RemoveObjectTagging(ctx, bucketName, dataName, opts)
 	if err != nil {
 		return err
 	}
@@ -1,15 +1,29 @@
 package ossClient
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	madmin "github.com/trinet2005/oss-admin-go"
 	"github.com/trinet2005/oss-go-sdk/pkg/credentials"
+	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
 	"github.com/trinet2005/oss-go-sdk/pkg/tags"
 	"io"
+	"io/fs"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -269,11 +283,10 @@ func TestClient_Vacancy(t *testing.T) {
 	}
 }
 
-// 测试开启版本控制的bucket操作失败
+// 测试开启版本控制的bucket上合并上传, 读取固定在索引记录的数据版本
 func TestClient_MergePartUpload2VersiondBucket(t *testing.T) {
 	// 创建测试的bucket
-	id := ""
-	bucket := "test-merge"
+	bucket := "test-merge-versioned"
 	opts := &Options{
 		Creds: credentials.NewStaticV4(AccessKeyIDDefault, SecretAccessKeyDefault, ""),
 	}
@@ -287,11 +300,1492 @@ func TestClient_MergePartUpload2VersiondBucket(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer client.RemoveBucket(context.Background(), bucket)
+	defer client.RemoveBucketWithOptions(context.Background(), bucket, RemoveBucketOptions{ForceDelete: true})
 
 	// 合并上传
-	p, err := client.InitMergePartUpload(id, bucket)
-	if p != nil || err == nil {
-		t.Fatal("can't operate on versiond bucket")
+	p, err := client.InitMergePartUpload("", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, err = p.UploadMergePart(name, strings.NewReader(RandomStr(100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = p.CompleteMergePartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	oldMeta, err := client.GetObjectIndexInfo(context.Background(), p.ID, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldMeta.DataVersionID == "" {
+		t.Fatal("data version not recorded")
+	}
+
+	// 删除并压缩后, 旧索引仍能读取保留的旧版本
+	if err = client.DeleteObjectWithId(context.Background(), p.ID, bucket, "a"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.CompactMergePack(context.Background(), bucket, p.ID, CompactMergePackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Compacted {
+		t.Fatal("compaction failed")
+	}
+	for _, meta := range []*ObjectIndexInfo{oldMeta, nil} {
+		if meta == nil {
+			if meta, err = client.GetObjectIndexInfo(context.Background(), p.ID, bucket); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := client.GetObjectWithIndex(context.Background(), p.ID, bucket, "b", meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.ReadAll(data); err != nil {
+			t.Fatal(err)
+		}
+		data.Close()
+	}
+}
+
+// 测试合并数据超出内存限制后落盘
+func TestMergeSpool(t *testing.T) {
+	s := newMergeSpool(t.TempDir(), 16)
+	defer s.release(context.Background())
+
+	if _, err := s.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if s.file != nil {
+		t.Fatal("spool should be kept in memory")
+	}
+	if _, err := s.Write([]byte("abcdefghij")); err != nil {
+		t.Fatal(err)
+	}
+	if s.file == nil {
+		t.Fatal("spool should be spilled to file")
+	}
+
+	// 回滚失败的写入
+	if _, err := s.Write([]byte("broken")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.truncate(20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("klm")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := io.ReadAll(s.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "0123456789abcdefghijklm" {
+		t.Fatal("spool data error", string(buf))
+	}
+}
+
+// 测试客户端压缩合并文件
+func TestClient_CompactMergePack(t *testing.T) {
+	fileNum := 100
+	testData := make(map[string]string)
+	for i := 1; i < fileNum; i++ {
+		testData[strconv.Itoa(i)] = RandomStr(i)
+	}
+
+	bucket := "test-merge"
+	client, err := New(EndpointDefault, &Options{
+		Creds: credentials.NewStaticV4(AccessKeyIDDefault, SecretAccessKeyDefault, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.MakeBucket(context.Background(), bucket, MakeBucketOptions{})
+	defer client.RemoveBucket(context.Background(), bucket)
+
+	p, err := client.InitMergePartUpload("", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := p.ID
+	for i := 1; i < fileNum; i++ {
+		_, err := p.UploadMergePart(strconv.Itoa(i), strings.NewReader(testData[strconv.Itoa(i)]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = p.CompleteMergePartUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteMergeID(context.Background(), id, bucket)
+
+	// 删除奇数对象制造空洞
+	for i := 1; i < fileNum; i += 2 {
+		err = client.DeleteObjectWithId(context.Background(), id, bucket, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 未达到阈值不压缩
+	info, err := client.CompactMergePack(context.Background(), bucket, id, CompactMergePackOptions{MinVacancyRatio: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Compacted {
+		t.Fatal("compaction should be skipped")
+	}
+
+	info, err = client.CompactMergePack(context.Background(), bucket, id, CompactMergePackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Compacted || info.ReclaimedSize == 0 {
+		t.Fatal("compaction failed")
+	}
+
+	meta, err := client.GetObjectIndexInfo(context.Background(), id, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.VacancySize != 0 || meta.TotalSize != info.NewTotalSize {
+		t.Fatal("compacted index error")
+	}
+	for i := 2; i < fileNum; i += 2 {
+		key := strconv.Itoa(i)
+		data, err := client.GetObjectWithIndex(context.Background(), id, bucket, key, meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := io.ReadAll(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(s) != testData[key] {
+			t.Fatal("get data error", key)
+		}
+		data.Close()
+	}
+}
+
+// 测试索引并发更新冲突时返回冲突错误
+func TestUpdateObjectIndexInfoConflict(t *testing.T) {
+	puts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("ETag", "\"etag\"")
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Write([]byte(`{"vacancySize":0,"totalSize":1,"objectNum":1,"objInfo":{"a":{"valid":true,"offset":0,"size":1}}}`))
+		case http.MethodPut:
+			puts++
+			if r.Header.Get("If-Match") != "\"etag\"" {
+				t.Errorf("unexpected If-Match %q", r.Header.Get("If-Match"))
+			}
+			w.WriteHeader(http.StatusPreconditionFailed)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetMergeIndexMaxAttempts(3)
+
+	_, err = client.updateObjectIndexInfo(context.Background(), "id", "bucket", func(meta *ObjectIndexInfo) error {
+		meta.Info["a"].Valid = false
+		return nil
+	})
+	var conflict MergeIndexConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected MergeIndexConflictError, got %v", err)
+	}
+	if conflict.Attempts != 3 || puts != 3 {
+		t.Fatalf("expected 3 attempts, got %d with %d puts", conflict.Attempts, puts)
+	}
+}
+
+// 测试列举合并文件
+func TestClient_ListMergePacks(t *testing.T) {
+	bucket := "test-merge"
+	client, err := New(EndpointDefault, &Options{
+		Creds: credentials.NewStaticV4(AccessKeyIDDefault, SecretAccessKeyDefault, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.MakeBucket(context.Background(), bucket, MakeBucketOptions{})
+	defer client.RemoveBucket(context.Background(), bucket)
+
+	p, err := client.InitMergePartUpload("", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		_, err := p.UploadMergePart(strconv.Itoa(i), strings.NewReader(RandomStr(10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = p.CompleteMergePartUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteMergeID(context.Background(), p.ID, bucket)
+
+	for i := 1; i <= 6; i++ {
+		err = client.DeleteObjectWithId(context.Background(), p.ID, bucket, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found := false
+	for pack := range client.ListMergePacks(context.Background(), bucket, ListMergePacksOptions{MinVacancyRatio: 0.5}) {
+		if pack.Err != nil {
+			t.Fatal(pack.Err)
+		}
+		if pack.ID == p.ID {
+			found = true
+			if pack.ObjectNum != 10 || pack.ValidNum != 4 || pack.TotalSize != 100 || pack.VacancySize != 60 {
+				t.Fatal("merge pack info error", pack)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("merge pack not listed")
+	}
+
+	for pack := range client.ListMergePacks(context.Background(), bucket, ListMergePacksOptions{MinVacancyRatio: 0.7}) {
+		if pack.Err != nil {
+			t.Fatal(pack.Err)
+		}
+		if pack.ID == p.ID {
+			t.Fatal("merge pack should be filtered")
+		}
+	}
+}
+
+// 测试读取合并对象时校验checksum
+func TestGetObjectWithIndexChecksum(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Length", "5")
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		stored string
+		ok     bool
+	}{
+		{"hello", true},
+		{"hellp", false},
+	} {
+		meta := &ObjectIndexInfo{
+			Info: map[string]*ObjectIndex{
+				"a": {
+					Valid:        true,
+					Size:         5,
+					ChecksumType: ChecksumCRC32C,
+					Checksum:     ChecksumCRC32C.ChecksumBytes([]byte(tc.stored)).Encoded(),
+				},
+			},
+		}
+		data, err := client.GetMergeObjectWithIndex(context.Background(), "id", "bucket", "a", meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadAll(data)
+		data.Close()
+
+		var mismatch MergeChecksumError
+		if tc.ok && err != nil {
+			t.Fatal(err)
+		}
+		if !tc.ok && !errors.As(err, &mismatch) {
+			t.Fatalf("expected MergeChecksumError, got %v", err)
+		}
+
+		// GetObjectWithIndex返回的Object同样校验
+		obj, err := client.GetObjectWithIndex(context.Background(), "id", "bucket", "a", meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadAll(obj)
+		obj.Close()
+		if tc.ok && err != nil {
+			t.Fatal(err)
+		}
+		if !tc.ok && !errors.As(err, &mismatch) {
+			t.Fatalf("expected MergeChecksumError from Object, got %v", err)
+		}
+	}
+}
+
+// 测试批量读取时合并相邻的读取范围
+func TestCoalesceMergeRanges(t *testing.T) {
+	entries := []mergeRangeEntry{
+		{name: "d", idx: &ObjectIndex{Offset: 1000, Size: 10}},
+		{name: "a", idx: &ObjectIndex{Offset: 0, Size: 10}},
+		{name: "c", idx: &ObjectIndex{Offset: 30, Size: 10}},
+		{name: "b", idx: &ObjectIndex{Offset: 10, Size: 10}},
+		{name: "e", idx: &ObjectIndex{Offset: 1010, Size: 100}},
+	}
+
+	ranges := coalesceMergeRanges(entries, 10, 100)
+	if len(ranges) != 3 {
+		t.Fatalf("expected 3 ranges, got %d", len(ranges))
+	}
+	expect := []struct {
+		start, end int64
+		names      string
+	}{
+		{0, 40, "abc"},
+		{1000, 1010, "d"},
+		{1010, 1110, "e"},
+	}
+	for i, r := range ranges {
+		names := ""
+		for _, e := range r.entries {
+			names += e.name
+		}
+		if r.start != expect[i].start || r.end != expect[i].end || names != expect[i].names {
+			t.Fatalf("range %d error: %d-%d %s", i, r.start, r.end, names)
+		}
+	}
+}
+
+// 测试重新打开合并文件并追加对象
+func TestClient_OpenMergePack(t *testing.T) {
+	bucket := "test-merge"
+	client, err := New(EndpointDefault, &Options{
+		Creds: credentials.NewStaticV4(AccessKeyIDDefault, SecretAccessKeyDefault, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.MakeBucket(context.Background(), bucket, MakeBucketOptions{})
+	defer client.RemoveBucket(context.Background(), bucket)
+
+	p, err := client.InitMergePartUpload("", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := p.ID
+	_, err = p.UploadMergePart("a", strings.NewReader("aaaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.UploadMergePart("b", strings.NewReader("bbbb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CompleteMergePartUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteMergeID(context.Background(), id, bucket)
+
+	// 追加新对象并覆盖旧对象
+	p, err = client.OpenMergePack(context.Background(), id, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.UploadMergePart("c", strings.NewReader("cccc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.UploadMergePart("a", strings.NewReader("AAAAAA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CompleteMergePartUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetObjectIndexInfo(context.Background(), id, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.TotalSize != 18 || meta.VacancySize != 4 || meta.ObjectNum != 3 {
+		t.Fatal("merge index error", meta.TotalSize, meta.VacancySize, meta.ObjectNum)
+	}
+	for key, expect := range map[string]string{"a": "AAAAAA", "b": "bbbb", "c": "cccc"} {
+		data, err := client.GetObjectWithIndex(context.Background(), id, bucket, key, meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := io.ReadAll(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(s) != expect {
+			t.Fatal("get data error", key)
+		}
+		data.Close()
+	}
+}
+
+// 测试索引缓存通过ETag重新校验
+func TestMergeIndexCache(t *testing.T) {
+	gets := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if r.Header.Get("If-None-Match") == "\"etag\"" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", "\"etag\"")
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Write([]byte(`{"vacancySize":0,"totalSize":1,"objectNum":1,"objInfo":{"a":{"valid":true,"offset":0,"size":1}}}`))
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.EnableMergeIndexCache(1)
+
+	meta, err := client.GetObjectIndexInfo(context.Background(), "id", "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 修改返回的索引不影响缓存
+	meta.Info["a"].Valid = false
+
+	meta, err = client.GetObjectIndexInfo(context.Background(), "id", "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Info["a"].Valid {
+		t.Fatal("cached index was modified")
+	}
+	stats := client.MergeIndexCacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || gets != 2 {
+		t.Fatal("cache stats error", stats, gets)
+	}
+
+	// 缓存容量为1时淘汰旧索引
+	_, err = client.GetObjectIndexInfo(context.Background(), "id2", "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = client.MergeIndexCacheStats()
+	if stats.Evictions != 1 || stats.Entries != 1 {
+		t.Fatal("cache eviction error", stats)
+	}
+}
+
+// 测试合并文件一致性检查与修复
+func TestClient_CheckMergePacks(t *testing.T) {
+	bucket := "test-merge-check"
+	client, err := New(EndpointDefault, &Options{
+		Creds: credentials.NewStaticV4(AccessKeyIDDefault, SecretAccessKeyDefault, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.MakeBucket(context.Background(), bucket, MakeBucketOptions{})
+	defer client.RemoveBucket(context.Background(), bucket)
+
+	gracePeriod := MergeOrphanGracePeriod
+	MergeOrphanGracePeriod = 0
+	defer func() { MergeOrphanGracePeriod = gracePeriod }()
+
+	// 没有索引的数据对象
+	_, err = client.PutObject(context.Background(), bucket, MergeDir+DataPrefix+"orphan", strings.NewReader("data"), 4, PutObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 索引中的对象超出数据长度
+	p, err := client.InitMergePartUpload("", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.UploadMergePart("a", strings.NewReader("aaaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CompleteMergePartUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteMergeID(context.Background(), p.ID, bucket)
+	_, err = client.updateObjectIndexInfo(context.Background(), p.ID, bucket, func(meta *ObjectIndexInfo) error {
+		meta.Info["b"] = &ObjectIndex{Valid: true, Offset: 4, Size: 4}
+		meta.TotalSize = 8
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := client.CheckMergePacks(context.Background(), bucket, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := make(map[MergePackProblem]bool)
+	for _, issue := range issues {
+		if !issue.Repaired {
+			t.Fatal("issue not repaired", issue)
+		}
+		problems[issue.Problem] = true
+	}
+	if !problems[MergeDataWithoutIndex] || !problems[MergeEntryOutOfRange] {
+		t.Fatal("check merge packs error", issues)
+	}
+
+	issues, err = client.CheckMergePacks(context.Background(), bucket, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Fatal("issues left after repair", issues)
+	}
+}
+
+// 测试二进制索引的编解码与按对象名的范围读取
+func TestBinaryMergeIndex(t *testing.T) {
+	meta := &ObjectIndexInfo{
+		VacancySize: 10,
+		Info:        make(map[string]*ObjectIndex),
+		DataETag:    "\"data\"",
+		Format:      MergeIndexBinary,
+	}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("obj-%04d", i)
+		meta.Info[name] = &ObjectIndex{Valid: i%3 != 0, Offset: int64(i) * 10, Size: 10}
+		meta.TotalSize += 10
+		meta.ObjectNum++
+	}
+	meta.Info["obj-0500"].ContentType = "text/plain"
+	meta.Info["obj-0500"].UserMetadata = map[string]string{"k": "v"}
+
+	buf, err := meta.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &ObjectIndexInfo{}
+	if err = decodeObjectIndexInfo(buf, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta, decoded) {
+		t.Fatal("binary index round trip error")
+	}
+
+	ranges := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranges++
+		}
+		w.Header().Set("ETag", "\"etag\"")
+		http.ServeContent(w, r, "", time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), bytes.NewReader(buf))
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := client.GetObjectIndexEntry(context.Background(), "id", "bucket", "obj-0500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Info) != 1 || !reflect.DeepEqual(entry.Info["obj-0500"], meta.Info["obj-0500"]) ||
+		entry.DataETag != meta.DataETag || entry.TotalSize != meta.TotalSize || ranges != 2 {
+		t.Fatal("binary index entry error", entry, ranges)
+	}
+	if _, err = client.GetObjectIndexEntry(context.Background(), "id", "bucket", "missing"); err == nil {
+		t.Fatal("expected missing entry error")
+	}
+}
+
+// 测试合并文件存储选项的记录与恢复, SSE-C密钥不记录
+func TestMergePackStorage(t *testing.T) {
+	kms, err := encrypt.NewSSEKMS("key", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &ObjectIndexInfo{Storage: newMergePackStorage(MergePackOptions{
+		ServerSideEncryption: kms,
+		StorageClass:         "REDUCED_REDUNDANCY",
+		PreferredEnginePool:  SSD,
+	})}
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &ObjectIndexInfo{}
+	if err = json.Unmarshal(buf, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := mergeDataPutOptions(decoded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, got := make(http.Header), make(http.Header)
+	kms.Marshal(want)
+	opts.ServerSideEncryption.Marshal(got)
+	if !reflect.DeepEqual(want, got) || opts.StorageClass != "REDUCED_REDUNDANCY" || opts.PreferredEnginePool != SSD {
+		t.Fatal("merge pack storage error", opts)
+	}
+
+	ssec, err := encrypt.NewSSEC(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newMergePackStorage(MergePackOptions{ServerSideEncryption: ssec}) != nil {
+		t.Fatal("SSE-C key must not be recorded")
+	}
+	opts, err = mergeDataPutOptions(decoded, ssec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ServerSideEncryption.Type() != encrypt.SSEC {
+		t.Fatal("SSE-C key not applied to the data object")
+	}
+}
+
+// 测试合并文件的fs.FS视图
+func TestMergePackFS(t *testing.T) {
+	files := map[string]string{
+		"index.html":      "<html></html>",
+		"css/site.css":    "body {}",
+		"css/img/a.png":   "png",
+		"js/app.js":       strings.Repeat("x", 1000),
+		"deleted.txt":     "gone",
+		"../invalid.txt":  "invalid",
+		"/root-slash.txt": "slash",
+	}
+	var data bytes.Buffer
+	meta := &ObjectIndexInfo{Info: make(map[string]*ObjectIndex), DataETag: "data"}
+	for name, content := range files {
+		meta.Info[name] = &ObjectIndex{
+			Valid:        name != "deleted.txt",
+			Offset:       int64(data.Len()),
+			Size:         int64(len(content)),
+			ChecksumType: ChecksumCRC32C,
+			Checksum:     ChecksumCRC32C.ChecksumBytes([]byte(content)).Encoded(),
+		}
+		data.WriteString(content)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "\"data\"")
+		http.ServeContent(w, r, "", time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), bytes.NewReader(data.Bytes()))
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := MergePackFSWithOptions(context.Background(), client, "bucket", "id", MergePackFSOptions{Index: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fstest.TestFS(fsys, "index.html", "css/site.css", "css/img/a.png", "js/app.js", "root-slash.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fsys.Open("deleted.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("deleted entry must not be visible", err)
+	}
+	b, err := fs.ReadFile(fsys, "js/app.js")
+	if err != nil || string(b) != files["js/app.js"] {
+		t.Fatal("read file error", err)
+	}
+}
+
+// 测试合并文件导出为tar并重新导入
+func TestExportImportMergePack(t *testing.T) {
+	entries := []struct {
+		name, content string
+		opts          MergePartOptions
+	}{
+		{"a.txt", "hello", MergePartOptions{ContentType: "text/plain", Checksum: ChecksumCRC32C}},
+		{"dir/b.bin", strings.Repeat("b", 1000), MergePartOptions{UserMetadata: map[string]string{"k": "v"}, ModTime: time.Unix(1700000000, 0)}},
+		{"deleted", "deleted", MergePartOptions{}},
+	}
+	src := &PutObjectMerge{meta: &ObjectIndexInfo{Info: make(map[string]*ObjectIndex)}, data: newMergeSpool(t.TempDir(), 0)}
+	defer src.data.release(context.Background())
+	for _, e := range entries {
+		if _, err := src.UploadMergePartWithOptions(e.name, strings.NewReader(e.content), e.opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src.meta.Info["deleted"].Valid = false
+	index, err := json.Marshal(src.meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(src.data.(*mergeSpool).reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := data
+		if strings.Contains(r.URL.Path, IdxPrefix) {
+			content = index
+		}
+		http.ServeContent(w, r, "", time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err = client.ExportMergePack(context.Background(), "bucket", "id", &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := &PutObjectMerge{meta: &ObjectIndexInfo{Info: make(map[string]*ObjectIndex)}, data: newMergeSpool(t.TempDir(), 0)}
+	defer dst.data.release(context.Background())
+	exported := archive.Bytes()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = importMergeEntries(ctx, dst, tar.NewReader(bytes.NewReader(exported))); err != context.Canceled {
+		t.Fatal("import not canceled", err)
+	}
+	if err = importMergeEntries(context.Background(), dst, tar.NewReader(bytes.NewReader(exported))); err != nil {
+		t.Fatal(err)
+	}
+	if dst.meta.ObjectNum != 2 {
+		t.Fatal("deleted entry exported", dst.meta.ObjectNum)
+	}
+	imported, err := io.ReadAll(dst.data.(*mergeSpool).reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries[:2] {
+		want, got := *src.meta.Info[e.name], *dst.meta.Info[e.name]
+		if string(imported[got.Offset:got.Offset+got.Size]) != e.content {
+			t.Fatal("imported data error", e.name)
+		}
+		want.Offset, got.Offset = 0, 0
+		if !reflect.DeepEqual(want, got) {
+			t.Fatal("imported index error", want, got)
+		}
+	}
+}
+
+// 测试将合并文件中的对象服务端拷贝为独立对象
+func TestClient_ExtractMergeEntry(t *testing.T) {
+	bucket := "test-merge"
+	client, err := New(EndpointDefault, &Options{
+		Creds: credentials.NewStaticV4(AccessKeyIDDefault, SecretAccessKeyDefault, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.MakeBucket(context.Background(), bucket, MakeBucketOptions{})
+	defer client.RemoveBucket(context.Background(), bucket)
+
+	p, err := client.InitMergePartUpload("", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testData := map[string]string{"a": RandomStr(100), "b": RandomStr(200)}
+	for _, name := range []string{"a", "b"} {
+		_, err = p.UploadMergePartWithOptions(name, strings.NewReader(testData[name]), MergePartOptions{ContentType: "text/plain"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = p.CompleteMergePartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteMergeID(context.Background(), p.ID, bucket)
+
+	dst := CopyDestOptions{Bucket: bucket, Object: "extracted-b"}
+	_, err = client.ExtractMergeEntryWithOptions(context.Background(), bucket, p.ID, "b", dst, ExtractMergeEntryOptions{Invalidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.RemoveObject(context.Background(), bucket, "extracted-b", RemoveObjectOptions{})
+
+	obj, err := client.GetObject(context.Background(), bucket, "extracted-b", GetObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	s, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s) != testData["b"] || info.ContentType != "text/plain" {
+		t.Fatal("extracted object error")
+	}
+
+	meta, err := client.GetObjectIndexInfo(context.Background(), p.ID, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Info["b"].Valid || !meta.Info["a"].Valid || meta.VacancySize != 200 {
+		t.Fatal("extracted entry not invalidated")
+	}
+}
+
+// mergeTestServer 在内存中模拟单个非多版本桶, 支持合并包用到的对象操作
+type mergeTestServer struct {
+	mu      sync.Mutex
+	objects map[string]*mergeTestObject
+	etag    int
+	// hook 在处理请求前被调用(持有锁), 返回非0状态码时直接以该状态码失败
+	hook func(s *mergeTestServer, r *http.Request, key string) int
+}
+
+type mergeTestObject struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+func newMergeTestServer(t *testing.T) (*mergeTestServer, *Client) {
+	s := &mergeTestServer{objects: make(map[string]*mergeTestObject)}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	client, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+// put 保存对象并分配新的ETag
+func (s *mergeTestServer) put(key string, data []byte) *mergeTestObject {
+	s.etag++
+	obj := &mergeTestObject{data: data, etag: fmt.Sprintf("\"etag%d\"", s.etag), modTime: time.Now()}
+	s.objects[key] = obj
+	return obj
+}
+
+// keys 返回指定前缀的对象名
+func (s *mergeTestServer) keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *mergeTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := ""
+	if parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2); len(parts) == 2 {
+		key = parts[1]
+	}
+	if s.hook != nil {
+		if status := s.hook(s, r, key); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	query := r.URL.Query()
+
+	if key == "" {
+		switch {
+		case query.Has("versioning"):
+			fmt.Fprint(w, `<VersioningConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></VersioningConfiguration>`)
+		case query.Get("list-type") == "2":
+			var keys []string
+			for k := range s.objects {
+				if strings.HasPrefix(k, query.Get("prefix")) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>`, len(keys))
+			for _, k := range keys {
+				obj := s.objects[k]
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>%s</LastModified><ETag>%s</ETag><Size>%d</Size></Contents>`,
+					k, obj.modTime.UTC().Format(time.RFC3339), obj.etag, len(obj.data))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+		}
+		return
+	}
+
+	obj := s.objects[key]
+	if obj == nil && r.Method != http.MethodPut {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if query.Has("tagging") {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `<Tagging><TagSet></TagSet></Tagging>`)
+		}
+		return
+	}
+	if m := r.Header.Get("If-Match"); m != "" && r.Method != http.MethodGet && r.Method != http.MethodHead &&
+		(obj == nil || trimEtag(m) != trimEtag(obj.etag)) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		w.Header().Set("ETag", obj.etag)
+		http.ServeContent(w, r, "", obj.modTime, bytes.NewReader(obj.data))
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAWSChunked(body)
+		}
+		if r.Header.Get("If-None-Match") == "*" && obj != nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get(MinIOPartialUpdateMode) == PartialUpdateInsertMode && r.Header.Get(MinIOPartialUpdateOffset) == "-1" {
+			if obj != nil {
+				body = append(append([]byte{}, obj.data...), body...)
+			}
+		}
+		obj = s.put(key, body)
+		w.Header().Set("ETag", obj.etag)
+	}
+}
+
+// newMergeTestPack 在模拟服务端上创建包含给定对象的合并包
+func newMergeTestPack(t *testing.T, client *Client, entries ...string) string {
+	p, err := client.InitMergePartUpload("", "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range entries {
+		if _, err = p.UploadMergePart(name, strings.NewReader(name+"-data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = p.CompleteMergePartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return p.ID
+}
+
+// 测试压缩写入新的数据对象并只通过索引的条件写入切换
+func TestCompactMergePackGeneration(t *testing.T) {
+	s, client := newMergeTestServer(t)
+	id := newMergeTestPack(t, client, "a", "b", "c")
+	for _, name := range []string{"a", "c"} {
+		if err := client.DeleteObjectWithId(context.Background(), id, "bucket", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldMeta, err := client.GetObjectIndexInfo(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 压缩期间索引被并发修改, 新数据对象被删除, 旧数据对象不变
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if r.Method == http.MethodPut && strings.HasPrefix(key, MergeDir+GenerationPrefix) {
+			idx := s.objects[MergeDir+IdxPrefix+id]
+			s.put(MergeDir+IdxPrefix+id, idx.data)
+		}
+		return 0
+	}
+	_, err = client.CompactMergePack(context.Background(), "bucket", id, CompactMergePackOptions{})
+	if !errors.As(err, &MergeIndexConflictError{}) {
+		t.Fatal("expected conflict", err)
+	}
+	if keys := s.keys(MergeDir + GenerationPrefix); len(keys) != 0 {
+		t.Fatal("compacted data object left", keys)
+	}
+	if keys := s.keys(MergeDir + DataPrefix); len(keys) != 1 {
+		t.Fatal("data object removed", keys)
+	}
+
+	s.hook = nil
+	info, err := client.CompactMergePack(context.Background(), "bucket", id, CompactMergePackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Compacted || info.NewTotalSize != int64(len("b-data")) || info.ObjectNum != 1 {
+		t.Fatal("compaction error", info)
+	}
+	if keys := s.keys(MergeDir + DataPrefix); len(keys) != 0 {
+		t.Fatal("old data object left", keys)
+	}
+	keys := s.keys(MergeDir + GenerationPrefix)
+	meta, err := client.GetObjectIndexInfo(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || meta.dataObjectName(id) != keys[0] {
+		t.Fatal("index does not refer to the compacted data", keys, meta.DataObject)
+	}
+
+	// 持有旧索引的读取重新加载索引
+	if _, err = client.GetMergeObjectWithIndex(context.Background(), id, "bucket", "b", oldMeta); ToErrorResponse(err).Code != "NoSuchKey" {
+		t.Fatal("stale index read the compacted data", err)
+	}
+	stale, err := client.GetObjectWithIndex(context.Background(), id, "bucket", "b", oldMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(stale); ToErrorResponse(err).Code != "NoSuchKey" {
+		t.Fatal("stale index read the compacted data", err)
+	}
+	stale.Close()
+	merged, _, err := client.GetMergeObjectWithID(context.Background(), id, "bucket", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(merged)
+	merged.Close()
+	if err != nil || string(b) != "b-data" {
+		t.Fatal("read after compaction error", string(b), err)
+	}
+	data, _, err := client.GetObjectWithID(context.Background(), id, "bucket", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(data)
+	data.Close()
+	if err != nil || string(b) != "b-data" {
+		t.Fatal("read after compaction error", string(b), err)
+	}
+
+	// 中断的压缩留下的数据对象由检查清理
+	gracePeriod := MergeOrphanGracePeriod
+	MergeOrphanGracePeriod = time.Hour
+	defer func() { MergeOrphanGracePeriod = gracePeriod }()
+	s.mu.Lock()
+	s.put(MergeDir+GenerationPrefix+id+".leftover", []byte("x")).modTime = time.Now().Add(-2 * time.Hour)
+	s.put(MergeDir+GenerationPrefix+id+".running", []byte("x"))
+	s.mu.Unlock()
+	issues, err := client.CheckMergePacks(context.Background(), "bucket", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Problem != MergeCompactLeftover || !issues[0].Repaired {
+		t.Fatal("check error", issues)
+	}
+	if keys := s.keys(MergeDir + GenerationPrefix); len(keys) != 2 || keys[0] != meta.dataObjectName(id) && keys[1] != meta.dataObjectName(id) {
+		t.Fatal("check removed the wrong data objects", keys)
+	}
+}
+
+// 测试自动压缩失败不影响删除
+func TestCompactByPolicyError(t *testing.T) {
+	s, client := newMergeTestServer(t)
+	id := newMergeTestPack(t, client, "a", "b")
+
+	var compactErr error
+	client.SetMergeCompactionPolicy(&MergeCompactionPolicy{
+		OnError: func(bucketName, packID string, err error) {
+			compactErr = err
+		},
+	})
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if strings.HasPrefix(key, MergeDir+GenerationPrefix) {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+	if err := client.DeleteObjectWithId(context.Background(), id, "bucket", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if compactErr == nil {
+		t.Fatal("compaction error not reported")
+	}
+	meta, err := client.GetObjectIndexInfo(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Info["a"].Valid || meta.DataObject != "" {
+		t.Fatal("delete not applied", meta)
+	}
+}
+
+// 测试无法读取的索引不中断合并包的列举
+func TestListMergePacksCorruptIndex(t *testing.T) {
+	s, client := newMergeTestServer(t)
+	good := newMergeTestPack(t, client, "a")
+	bad := newMergeTestPack(t, client, "b")
+	s.mu.Lock()
+	s.put(MergeDir+IdxPrefix+bad, []byte("corrupt"))
+	s.mu.Unlock()
+
+	var listed, failed []string
+	for pack := range client.ListMergePacks(context.Background(), "bucket", ListMergePacksOptions{}) {
+		if pack.Err != nil {
+			failed = append(failed, pack.ID)
+			continue
+		}
+		listed = append(listed, pack.ID)
+	}
+	if len(listed) != 1 || listed[0] != good || len(failed) != 1 || failed[0] != bad {
+		t.Fatal("list merge packs error", listed, failed)
+	}
+}
+
+// 测试读取合并包中间位置的对象只返回该对象的数据
+func TestGetObjectWithIndexRange(t *testing.T) {
+	s, client := newMergeTestServer(t)
+	id := newMergeTestPack(t, client, "a", "b", "c")
+	for _, name := range []string{"a", "b", "c"} {
+		data, _, err := client.GetObjectWithID(context.Background(), id, "bucket", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(data)
+		data.Close()
+		if err != nil || string(b) != name+"-data" {
+			t.Fatal("read entry error", name, string(b), err)
+		}
+	}
+	// 读取前不发送HEAD，数据对象变化时重新读取索引
+	var heads, failed int
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if !strings.HasPrefix(key, MergeDir+DataPrefix) {
+			return 0
+		}
+		if r.Method == http.MethodHead {
+			heads++
+		}
+		if r.Method == http.MethodGet && failed == 0 {
+			failed++
+			return http.StatusPreconditionFailed
+		}
+		return 0
+	}
+	merged, _, err := client.GetMergeObjectWithID(context.Background(), id, "bucket", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(merged)
+	merged.Close()
+	if err != nil || string(b) != "b-data" || heads != 0 || failed != 1 {
+		t.Fatal("merge object read error", string(b), heads, failed, err)
+	}
+}
+
+// 测试重新打开的合并包只追加到打开时的数据对象
+func TestOpenMergePackAppendGuard(t *testing.T) {
+	s, client := newMergeTestServer(t)
+	id := newMergeTestPack(t, client, "a")
+	dataName := MergeDir + DataPrefix + id
+
+	p, err := client.OpenMergePack(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.UploadMergePart("b", strings.NewReader("b-data")); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CompleteMergePartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := client.GetObjectWithID(context.Background(), id, "bucket", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(data)
+	data.Close()
+	if err != nil || string(b) != "b-data" {
+		t.Fatal("read appended entry error", string(b), err)
+	}
+
+	// 其他写入者在检查与追加之间写入了数据对象
+	p, err = client.OpenMergePack(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.UploadMergePart("c", strings.NewReader("c-data")); err != nil {
+		t.Fatal(err)
+	}
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if r.Method == http.MethodPut && key == dataName {
+			s.hook = nil
+			s.put(key, append(s.objects[key].data, "other"...))
+		}
+		return 0
+	}
+	if err = p.CompleteMergePartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	content := string(s.objects[dataName].data)
+	s.mu.Unlock()
+	if content != "a-datab-dataotherc-data" {
+		t.Fatal("data not appended after the concurrent write", content)
+	}
+	read := func(name string) string {
+		data, _, err := client.GetMergeObjectWithID(context.Background(), id, "bucket", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(data)
+		data.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	meta, err := client.GetObjectIndexInfo(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read("c") != "c-data" || meta.VacancySize != int64(len("other")) || meta.TotalSize != int64(len(content)) {
+		t.Fatal("rebased index error", read("c"), meta.VacancySize, meta.TotalSize)
+	}
+
+	// 追加成功后索引被并发修改，重新读取索引后加入新条目
+	indexName := MergeDir + IdxPrefix + id
+	concurrentDelete := func(s *mergeTestServer, r *http.Request, key string) int {
+		if r.Method == http.MethodPut && key == indexName {
+			s.hook = nil
+			latest := &ObjectIndexInfo{Info: make(map[string]*ObjectIndex)}
+			if err := decodeObjectIndexInfo(s.objects[key].data, latest); err != nil {
+				t.Error(err)
+				return 0
+			}
+			latest.Info["a"].Valid = false
+			latest.VacancySize += latest.Info["a"].Size
+			buf, _ := encodeObjectIndexInfo(latest)
+			s.put(key, buf)
+		}
+		return 0
+	}
+	p, err = client.OpenMergePack(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.UploadMergePart("d", strings.NewReader("d-data")); err != nil {
+		t.Fatal(err)
+	}
+	s.hook = concurrentDelete
+	if err = p.CompleteMergePartUpload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = client.GetObjectIndexInfo(context.Background(), id, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Info["a"].Valid || read("d") != "d-data" || meta.ObjectNum != 4 || meta.VacancySize != int64(len("other")+len("a-data")) {
+		t.Fatal("index update not merged", meta.Info["a"].Valid, meta.ObjectNum, meta.VacancySize)
+	}
+
+	// 只允许一次尝试时返回冲突
+	client.SetMergeIndexMaxAttempts(1)
+	defer client.SetMergeIndexMaxAttempts(0)
+	p, err = client.OpenMergePack(context.Background(), id, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.UploadMergePart("e", strings.NewReader("e-data")); err != nil {
+		t.Fatal(err)
+	}
+	s.hook = concurrentDelete
+	var conflict MergeIndexConflictError
+	if err = p.CompleteMergePartUpload(context.Background()); !errors.As(err, &conflict) || conflict.Attempts != 1 {
+		t.Fatal("expected conflict", err)
+	}
+}
+
+// 测试使用中开关索引缓存没有数据竞争
+func TestMergeIndexCacheToggle(t *testing.T) {
+	_, client := newMergeTestServer(t)
+	id := newMergeTestPack(t, client, "a")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			client.EnableMergeIndexCache(i % 2)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := client.GetObjectIndexInfo(context.Background(), id, "bucket"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	client.MergeIndexCacheStats()
+}
+
+// 测试使用中修改压缩策略和索引更新次数
+func TestMergeSettingsConcurrent(t *testing.T) {
+	_, client := newMergeTestServer(t)
+	names := []string{"a", "b", "c", "d", "e", "f"}
+	id := newMergeTestPack(t, client, names...)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			client.SetMergeIndexMaxAttempts(i % 3)
+			if i%2 == 0 {
+				client.SetMergeCompactionPolicy(&MergeCompactionPolicy{MinVacancyRatio: 2})
+			} else {
+				client.SetMergeCompactionPolicy(nil)
+			}
+		}
+	}()
+	for _, name := range names {
+		if err := client.DeleteObjectWithId(context.Background(), id, "bucket", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if client.indexAttempts() < 1 {
+		t.Fatal("index attempts error", client.indexAttempts())
+	}
+}
+
+// 测试没有数据对象的索引在宽限期后经复查才被删除
+func TestCheckMergePacksIndexWithoutData(t *testing.T) {
+	s, client := newMergeTestServer(t)
+	id := newMergeTestPack(t, client, "a")
+	indexName, dataName := MergeDir+IdxPrefix+id, MergeDir+DataPrefix+id
+	s.mu.Lock()
+	data := s.objects[dataName]
+	delete(s.objects, dataName)
+	s.mu.Unlock()
+
+	gracePeriod := MergeOrphanGracePeriod
+	MergeOrphanGracePeriod = time.Hour
+	defer func() { MergeOrphanGracePeriod = gracePeriod }()
+	check := func() []MergePackIssue {
+		issues, err := client.CheckMergePacks(context.Background(), "bucket", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issues
+	}
+
+	// 宽限期内的索引不处理
+	if issues := check(); len(issues) != 0 {
+		t.Fatal("index in grace period reported", issues)
+	}
+	s.mu.Lock()
+	s.objects[indexName].modTime = time.Now().Add(-2 * time.Hour)
+	s.mu.Unlock()
+
+	// 列举之后数据对象出现
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if r.Method == http.MethodHead && key == dataName {
+			s.objects[dataName] = data
+		}
+		return 0
+	}
+	if issues := check(); len(issues) != 0 {
+		t.Fatal("index with data reported", issues)
+	}
+
+	// 删除前索引被其他写入者更新
+	s.mu.Lock()
+	delete(s.objects, dataName)
+	s.mu.Unlock()
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if r.Method == http.MethodDelete && key == indexName {
+			s.hook = nil
+			s.put(key, s.objects[key].data).modTime = time.Now().Add(-2 * time.Hour)
+		}
+		return 0
+	}
+	issues := check()
+	if len(issues) != 1 || issues[0].Problem != MergeIndexWithoutData || issues[0].Repaired || !isPreconditionFailed(issues[0].Err) {
+		t.Fatal("changed index removed", issues)
+	}
+
+	issues = check()
+	if len(issues) != 1 || issues[0].Problem != MergeIndexWithoutData || !issues[0].Repaired {
+		t.Fatal("index without data not repaired", issues)
+	}
+	if keys := s.keys(MergeDir); len(keys) != 0 {
+		t.Fatal("objects left", keys)
+	}
+}
+
+// 测试二进制索引的范围读取固定在同一版本, 并拒绝越界的块位置
+func TestBinaryMergeIndexPinned(t *testing.T) {
+	newIndex := func(offset int64) []byte {
+		meta := &ObjectIndexInfo{Info: make(map[string]*ObjectIndex), Format: MergeIndexBinary}
+		for i := 0; i < 1000; i++ {
+			meta.Info[fmt.Sprintf("obj-%04d", i)] = &ObjectIndex{Valid: true, Offset: offset + int64(i)*10, Size: 10}
+		}
+		buf, err := meta.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+	s, client := newMergeTestServer(t)
+	indexName := MergeDir + IdxPrefix + "id"
+	s.put(indexName, newIndex(0))
+
+	// 读取尾部之后索引被替换, 改为完整读取新索引
+	s.hook = func(s *mergeTestServer, r *http.Request, key string) int {
+		if r.Method == http.MethodGet && key == indexName && r.Header.Get("If-Match") != "" {
+			s.hook = nil
+			s.put(indexName, newIndex(100000))
+		}
+		return 0
+	}
+	entry, err := client.GetObjectIndexEntry(context.Background(), "id", "bucket", "obj-0500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Info["obj-0500"].Offset != 105000 {
+		t.Fatal("entry read from two index versions", entry.Info["obj-0500"])
+	}
+
+	// 块位置为负数或超出索引
+	for _, off := range []uint64{1 << 63, 1 << 40, 0} {
+		buf := newIndex(0)
+		fenceLen := binary.LittleEndian.Uint32(buf[len(buf)-12:])
+		binary.LittleEndian.PutUint64(buf[len(buf)-binaryIndexFooterSize-int(fenceLen):], off)
+		if err = decodeObjectIndexInfo(buf, &ObjectIndexInfo{}); err != errInvalidBinaryIndex {
+			t.Fatal("invalid block offset accepted", off, err)
+		}
+		s.mu.Lock()
+		s.put(indexName, buf)
+		s.mu.Unlock()
+		if _, err = client.GetObjectIndexEntry(context.Background(), "id", "bucket", "obj-0000"); err != errInvalidBinaryIndex {
+			t.Fatal("invalid block offset accepted", off, err)
+		}
 	}
 }
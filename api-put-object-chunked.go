@@ -0,0 +1,299 @@
+package ossClient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// defaultChunkedUploadSize - bytes written per call by a chunked session.
+	defaultChunkedUploadSize = 1024 * 1024 * 64
+	// defaultChunkedUploadRetries - retries of a failed call of a chunked session.
+	defaultChunkedUploadRetries = 3
+)
+
+// ChunkedUploadOptions configures AppendObjectChunked and UpdateObjectChunked.
+type ChunkedUploadOptions struct {
+	ChunkSize  int64     // bytes written per call, default 64MiB, less than 5GiB
+	MaxRetries int       // retries of a failed call, default 3, negative for none
+	Progress   io.Reader // reads the data of every chunk once it is written, as PutObjectOptions.Progress
+}
+
+// chunkedSession writes a payload to an object with successive calls of
+// write, one per chunk.
+type chunkedSession struct {
+	c          *Client
+	bucketName string
+	objectName string
+	opts       ChunkedUploadOptions
+
+	// Writing a chunk twice gives the same object, a failed call is
+	// simply repeated. Otherwise the size of the object tells whether a
+	// failed call was applied.
+	idempotent bool
+	size       int64 // expected size of the object if not idempotent
+
+	// removed returns the bytes the first write removes from an object of
+	// size bytes before adding its data, nil if it removes none.
+	removed func(size int64) (int64, error)
+	shrink  int64 // bytes the next write removes
+
+	write func(ctx context.Context, r io.Reader, n, written int64) (UploadInfo, error)
+}
+
+// AppendObjectChunked appends reader to the object with as many
+// AppendObject calls as needed, objectSize may be -1 to read up to EOF.
+// Every chunk is appended with AppendObjectWithOptions at the size the
+// object had when the session started plus the bytes appended so far, so a
+// failed call is retried only if it was not applied and a write by anybody
+// else meanwhile fails the session with ErrAppendPositionMismatch.
+// The returned UploadInfo is the one of the last call with Size set to the
+// bytes appended; on error Size is the bytes appended before the failure.
+func (c *Client) AppendObjectChunked(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts ChunkedUploadOptions) (UploadInfo, error) {
+	return c.newAppendSession(bucketName, objectName, opts).run(ctx, reader, objectSize)
+}
+
+// newAppendSession returns a session appending every chunk at the expected
+// size of the object, which is set by run or by the caller.
+func (c *Client) newAppendSession(bucketName, objectName string, opts ChunkedUploadOptions) *chunkedSession {
+	s := &chunkedSession{
+		c:          c,
+		bucketName: bucketName,
+		objectName: objectName,
+		opts:       opts,
+	}
+	s.write = func(ctx context.Context, r io.Reader, n, _ int64) (UploadInfo, error) {
+		var appendOpts AppendObjectOptions
+		if err := appendOpts.SetExpectedSize(s.size); err != nil {
+			return UploadInfo{}, err
+		}
+		return c.AppendObjectWithOptions(ctx, s.bucketName, s.objectName, r, n, appendOpts)
+	}
+	return s
+}
+
+// UpdateObjectChunked is UpdateObjectRange for payloads of any size, the
+// chunks are inserted or replaced one after the other from updateOffset
+// on, or at the end of the object for an offset of -1. objectSize may be -1
+// to read up to EOF. Failed calls are retried as by AppendObjectChunked.
+// updateLength is only used by PartialUpdateDeleteMode and must be 0
+// otherwise. PartialUpdateDeleteMode and PartialUpdateTruncateMode remove
+// the range, or cut the object, with the first chunk through
+// PartialUpdateObject and insert the others after it; without data they
+// are still applied with a single call.
+func (c *Client) UpdateObjectChunked(ctx context.Context, bucketName, objectName string, updateMod string, updateOffset int,
+	updateLength int64, reader io.Reader, objectSize int64, opts ChunkedUploadOptions,
+) (UploadInfo, error) {
+	info := PartialUpdateInfo{
+		UpdateMode:   updateMod,
+		UpdateOffset: strconv.Itoa(updateOffset),
+	}
+	if updateLength != 0 {
+		info.UpdateLength = strconv.FormatInt(updateLength, 10)
+	}
+	if _, _, err := info.parse(); err != nil {
+		return UploadInfo{}, err
+	}
+
+	s := &chunkedSession{
+		c:          c,
+		bucketName: bucketName,
+		objectName: objectName,
+		opts:       opts,
+		idempotent: updateMod == PartialUpdateReplaceMode && updateOffset >= 0,
+		write: func(ctx context.Context, r io.Reader, n, written int64) (UploadInfo, error) {
+			mode, offset, length := updateMod, updateOffset, updateLength
+			if offset >= 0 {
+				offset += int(written)
+			}
+			if written > 0 && (mode == PartialUpdateDeleteMode || mode == PartialUpdateTruncateMode) {
+				mode, length = PartialUpdateInsertMode, 0
+			}
+			return c.UpdateObjectRange(ctx, bucketName, objectName, mode, offset, length, r, n)
+		},
+	}
+	switch updateMod {
+	case PartialUpdateDeleteMode:
+		s.removed = func(size int64) (int64, error) {
+			return updateLength, info.check(size)
+		}
+	case PartialUpdateTruncateMode:
+		s.removed = func(size int64) (int64, error) {
+			return size - int64(updateOffset), info.check(size)
+		}
+	}
+	return s.run(ctx, reader, objectSize)
+}
+
+// run writes objectSize bytes of reader, or everything up to EOF if
+// objectSize is -1.
+func (s *chunkedSession) run(ctx context.Context, reader io.Reader, objectSize int64) (UploadInfo, error) {
+	chunkSize := s.opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkedUploadSize
+	}
+	if chunkSize >= maxPartSize {
+		return UploadInfo{}, errInvalidArgument("Chunk size must be smaller than 5GiB.")
+	}
+	if objectSize >= 0 && objectSize < chunkSize {
+		chunkSize = objectSize
+	}
+
+	if !s.idempotent {
+		size, err := s.objectSize(ctx)
+		if err != nil {
+			return UploadInfo{}, err
+		}
+		s.size = size
+	}
+	if s.removed != nil {
+		shrink, err := s.removed(s.size)
+		if err != nil {
+			return UploadInfo{}, err
+		}
+		s.shrink = shrink
+	}
+
+	info := UploadInfo{Bucket: s.bucketName, Key: s.objectName}
+	buf := make([]byte, chunkSize)
+	var written int64
+	for objectSize < 0 || written < objectSize {
+		chunk := buf
+		if objectSize >= 0 && objectSize-written < int64(len(chunk)) {
+			chunk = chunk[:objectSize-written]
+		}
+
+		n, rerr := readFull(reader, chunk)
+		if rerr != nil && rerr != io.ErrUnexpectedEOF && rerr != io.EOF {
+			info.Size = written
+			return info, rerr
+		}
+		if objectSize >= 0 && n < len(chunk) {
+			info.Size = written
+			return info, errUnexpectedEOF(written+int64(n), objectSize, s.bucketName, s.objectName)
+		}
+		if n == 0 {
+			break
+		}
+
+		chunkInfo, err := s.writeChunk(ctx, chunk[:n], written)
+		if err != nil {
+			info.Size = written
+			return info, err
+		}
+		info = chunkInfo
+		written += int64(n)
+		s.size += int64(n) - s.shrink
+		s.shrink = 0
+		if s.opts.Progress != nil {
+			s.opts.Progress.Read(chunk[:n])
+		}
+
+		// A short chunk of an unknown size payload is the last one.
+		if n < len(chunk) {
+			break
+		}
+	}
+
+	// A removal is written even without data.
+	if written == 0 && s.shrink > 0 {
+		chunkInfo, err := s.writeChunk(ctx, nil, 0)
+		if err != nil {
+			return info, err
+		}
+		info = chunkInfo
+		s.size -= s.shrink
+		s.shrink = 0
+	}
+
+	info.Bucket, info.Key, info.Size = s.bucketName, s.objectName, written
+	return info, nil
+}
+
+// writeChunk writes data, the chunk starting written bytes into the
+// payload, retrying failed calls.
+func (s *chunkedSession) writeChunk(ctx context.Context, data []byte, written int64) (UploadInfo, error) {
+	retries := s.opts.MaxRetries
+	if retries == 0 {
+		retries = defaultChunkedUploadRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	var err error
+	for attempt := range s.c.newRetryTimer(ctx, retries+1, DefaultRetryUnit, DefaultRetryCap, MaxJitter) {
+		if attempt > 1 && !s.idempotent {
+			// The failed call may have been applied before the error.
+			st, serr := s.c.StatObject(ctx, s.bucketName, s.objectName, StatObjectOptions{})
+			if serr != nil && ToErrorResponse(serr).Code != "NoSuchKey" {
+				return UploadInfo{}, serr
+			}
+			if s.shrink > 0 && s.shrink == int64(len(data)) {
+				return UploadInfo{}, fmt.Errorf("object %s keeps its size of %d bytes with the failed write, it may have been applied",
+					s.objectName, s.size)
+			}
+			switch st.Size {
+			case s.size - s.shrink + int64(len(data)):
+				return UploadInfo{
+					Bucket:    s.bucketName,
+					Key:       s.objectName,
+					ETag:      st.ETag,
+					VersionID: st.VersionID,
+				}, nil
+			case s.size:
+			default:
+				return UploadInfo{}, fmt.Errorf("object %s has %d bytes while %d were expected, it was changed during the chunked write",
+					s.objectName, st.Size, s.size)
+			}
+		}
+
+		var info UploadInfo
+		info, err = s.write(ctx, bytes.NewReader(data), int64(len(data)), written)
+		if err == nil {
+			return info, nil
+		}
+		var mismatch ErrAppendPositionMismatch
+		if errors.As(err, &mismatch) {
+			if mismatch.ActualSize != s.size+int64(len(data)) {
+				return UploadInfo{}, err
+			}
+			// A retry of the request after the append was applied.
+			return UploadInfo{
+				Bucket: s.bucketName,
+				Key:    s.objectName,
+				ETag:   mismatch.ActualETag,
+			}, nil
+		}
+		if !isChunkRetryable(err) {
+			return UploadInfo{}, err
+		}
+	}
+	if ctx.Err() != nil {
+		return UploadInfo{}, ctx.Err()
+	}
+	return UploadInfo{}, err
+}
+
+// objectSize returns the size of the object, 0 if it does not exist.
+func (s *chunkedSession) objectSize(ctx context.Context) (int64, error) {
+	st, err := s.c.StatObject(ctx, s.bucketName, s.objectName, StatObjectOptions{})
+	if err != nil {
+		if ToErrorResponse(err).Code == "NoSuchKey" {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return st.Size, nil
+}
+
+// isChunkRetryable - whether a failed call of a chunked session is retried.
+func isChunkRetryable(err error) bool {
+	if errResp := ToErrorResponse(err); errResp.Code != "" {
+		return isS3CodeRetryable(errResp.Code) || isHTTPStatusRetryable(errResp.StatusCode)
+	}
+	return isRequestErrorRetryable(err)
+}
@@ -0,0 +1,118 @@
+package ossClient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// parse checks the mode of the update and returns its offset and length,
+// the length is 0 for all but PartialUpdateDeleteMode.
+func (info PartialUpdateInfo) parse() (offset, length int64, err error) {
+	offset, err = strconv.ParseInt(info.UpdateOffset, 10, 64)
+	if err != nil {
+		return 0, 0, errInvalidArgument(fmt.Sprintf("Invalid partial update offset %q.", info.UpdateOffset))
+	}
+
+	switch info.UpdateMode {
+	case PartialUpdateInsertMode, PartialUpdateReplaceMode:
+		if offset < -1 {
+			return 0, 0, errInvalidArgument("Partial update offset must be -1 or greater.")
+		}
+	case PartialUpdateDeleteMode, PartialUpdateTruncateMode:
+		if offset < 0 {
+			return 0, 0, errInvalidArgument(fmt.Sprintf("%s offset cannot be negative.", info.UpdateMode))
+		}
+	default:
+		return 0, 0, errInvalidArgument(fmt.Sprintf("Unsupported partial update mode %q.", info.UpdateMode))
+	}
+
+	if info.UpdateMode != PartialUpdateDeleteMode {
+		if info.UpdateLength != "" {
+			return 0, 0, errInvalidArgument("Partial update length is only used by the Delete mode.")
+		}
+		return offset, 0, nil
+	}
+	length, err = strconv.ParseInt(info.UpdateLength, 10, 64)
+	if err != nil || length <= 0 {
+		return 0, 0, errInvalidArgument(fmt.Sprintf("Invalid partial update length %q, Delete removes at least one byte.", info.UpdateLength))
+	}
+	return offset, length, nil
+}
+
+// check validates the update against the current size of the object.
+func (info PartialUpdateInfo) check(size int64) error {
+	offset, length, err := info.parse()
+	if err != nil {
+		return err
+	}
+	if offset > size {
+		return errInvalidArgument(fmt.Sprintf("Partial update offset %d is beyond the object size %d.", offset, size))
+	}
+	if offset+length > size {
+		return errInvalidArgument(fmt.Sprintf("Deleting %d bytes at offset %d goes beyond the object size %d.", length, offset, size))
+	}
+	return nil
+}
+
+// PartialUpdateObject updates an existing object with any partial update
+// mode. The update is checked against the current size of the object and
+// is only applied if the object still has the ETag it had when checked.
+// With PartialUpdateDeleteMode and PartialUpdateTruncateMode reader may be
+// nil for an objectSize of 0, otherwise its data is inserted at the offset
+// once the range is removed, which replaces a range by data of another
+// length or the end of the object.
+func (c *Client) PartialUpdateObject(ctx context.Context, bucketName, objectName string, info PartialUpdateInfo,
+	reader io.Reader, objectSize int64,
+) (UploadInfo, error) {
+	if objectSize >= maxPartSize {
+		return UploadInfo{}, errors.New("update file is too large")
+	}
+	if objectSize < 0 {
+		return UploadInfo{}, errors.New("update file is too small, Update can't use steaming upload")
+	}
+	if _, _, err := info.parse(); err != nil {
+		return UploadInfo{}, err
+	}
+
+	st, err := c.StatObject(ctx, bucketName, objectName, StatObjectOptions{})
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	if err = info.check(st.Size); err != nil {
+		return UploadInfo{}, err
+	}
+
+	opts := PutObjectOptions{
+		PartialUpdateInfo: info,
+		DisableMultipart:  true,
+		PartSize:          maxPartSize,
+	}
+	if etag := trimEtag(st.ETag); etag != "" {
+		opts.SetMatchETag(etag)
+	}
+	if reader == nil {
+		reader = bytes.NewReader(nil)
+	}
+	return c.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+}
+
+// DeleteObjectRange removes length bytes from offset on out of the object.
+func (c *Client) DeleteObjectRange(ctx context.Context, bucketName, objectName string, offset, length int64) (UploadInfo, error) {
+	return c.PartialUpdateObject(ctx, bucketName, objectName, PartialUpdateInfo{
+		UpdateMode:   PartialUpdateDeleteMode,
+		UpdateOffset: strconv.FormatInt(offset, 10),
+		UpdateLength: strconv.FormatInt(length, 10),
+	}, nil, 0)
+}
+
+// TruncateObject cuts the object to size bytes.
+func (c *Client) TruncateObject(ctx context.Context, bucketName, objectName string, size int64) (UploadInfo, error) {
+	return c.PartialUpdateObject(ctx, bucketName, objectName, PartialUpdateInfo{
+		UpdateMode:   PartialUpdateTruncateMode,
+		UpdateOffset: strconv.FormatInt(size, 10),
+	}, nil, 0)
+}
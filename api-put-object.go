@@ -23,7 +23,6 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"net/http"
 	"sort"
@@ -115,6 +114,7 @@ type PutObjectOptions struct {
 	AmzSnowballExtract       bool              // online extract
 	MinIOSnowballIgnoreDirs  bool              // ignore dirs when extract upload
 	MinIOSnowballUpdateMTime bool              // update mtime when extract upload
+	AutoChecksum             ChecksumType      // checksum of parts and the hash of hashes of multipart uploads, CRC32C if not set
 	/* trinet */
 
 	Internal AdvancedPutOptions
@@ -126,11 +126,18 @@ type PutObjectOptions struct {
 const (
 	PartialUpdateInsertMode  = "Insert"
 	PartialUpdateReplaceMode = "Replace"
+	// PartialUpdateDeleteMode removes UpdateLength bytes from UpdateOffset
+	// on, the data of the request is then inserted at UpdateOffset.
+	PartialUpdateDeleteMode = "Delete"
+	// PartialUpdateTruncateMode cuts the object to UpdateOffset bytes, the
+	// data of the request is then appended.
+	PartialUpdateTruncateMode = "Truncate"
 )
 
 type PartialUpdateInfo struct {
 	UpdateMode   string
 	UpdateOffset string
+	UpdateLength string // bytes removed by PartialUpdateDeleteMode
 }
 
 /* trinet */
@@ -155,6 +162,28 @@ func (opts *PutObjectOptions) SetMatchETagExcept(etag string) {
 	opts.customHeaders.Set("If-None-Match", "\""+etag+"\"")
 }
 
+/* trinet */
+
+// checksumType - the checksum added to uploads without MD5, AutoChecksum
+// or CRC32C which is the fastest.
+func (opts PutObjectOptions) checksumType() ChecksumType {
+	if opts.AutoChecksum.IsSet() {
+		return opts.AutoChecksum
+	}
+	return ChecksumCRC32C
+}
+
+// validateChecksum - rejects an AutoChecksum that is not a single known
+// checksum type, checksumType would replace it by CRC32C.
+func (opts PutObjectOptions) validateChecksum() error {
+	if opts.AutoChecksum != ChecksumNone && (!opts.AutoChecksum.IsSet() || opts.AutoChecksum&^checksumMask != 0) {
+		return errInvalidArgument(fmt.Sprintf("Unsupported AutoChecksum type %d.", uint32(opts.AutoChecksum)))
+	}
+	return nil
+}
+
+/* trinet */
+
 // getNumThreads - gets the number of threads to be used in the multipart
 // put object operation
 func (opts PutObjectOptions) getNumThreads() (numThreads int) {
@@ -242,6 +271,9 @@ func (opts PutObjectOptions) Header() (header http.Header) {
 	if opts.PartialUpdateInfo.UpdateMode != "" && opts.PartialUpdateInfo.UpdateOffset != "" {
 		header.Set(MinIOPartialUpdateMode, opts.PartialUpdateInfo.UpdateMode)
 		header.Set(MinIOPartialUpdateOffset, opts.PartialUpdateInfo.UpdateOffset)
+		if opts.PartialUpdateInfo.UpdateLength != "" {
+			header.Set(MinIOPartialUpdateLength, opts.PartialUpdateInfo.UpdateLength)
+		}
 	}
 	if opts.AppendMode {
 		// TODO: 目前使用局部更新的方式来实现，后续优化成增加part的方式
@@ -297,6 +329,15 @@ func (opts PutObjectOptions) validate() (err error) {
 	if opts.PreferredEnginePool != "" && (opts.AppendMode || opts.PartialUpdateInfo.UpdateMode != "") {
 		return errInvalidArgument("PreferredEnginePool parameter is only used to transfer new objects")
 	}
+	// Like Header, an update without offset is not sent.
+	if opts.PartialUpdateInfo.UpdateMode != "" && opts.PartialUpdateInfo.UpdateOffset != "" {
+		if _, _, err = opts.PartialUpdateInfo.parse(); err != nil {
+			return err
+		}
+	}
+	if err = opts.validateChecksum(); err != nil {
+		return err
+	}
 	/* trinet */
 
 	for k, v := range opts.UserMetadata {
@@ -345,13 +386,35 @@ func (c *Client) ExtractOnline(ctx context.Context, bucketName string, reader io
 	return c.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
 }
 
+// UpdateObject updates the object at updateOffset with any partial update
+// mode but PartialUpdateDeleteMode, which needs the length of the range
+// removed and is done by UpdateObjectRange.
 func (c *Client) UpdateObject(ctx context.Context, bucketName, objectName string, updateMod string, updateOffset int,
 	reader io.Reader, objectSize int64) (UploadInfo, error) {
-	if updateMod != PartialUpdateInsertMode && updateMod != PartialUpdateReplaceMode {
-		return UploadInfo{}, errors.New("unsupported mode")
+	return c.UpdateObjectRange(ctx, bucketName, objectName, updateMod, updateOffset, 0, reader, objectSize)
+}
+
+// UpdateObjectRange is UpdateObject with updateLength, the bytes removed
+// from updateOffset on by PartialUpdateDeleteMode, it must be 0 for the
+// other modes. With PartialUpdateDeleteMode the data of reader is then
+// inserted at updateOffset, with PartialUpdateTruncateMode it is appended
+// once the object is cut to updateOffset. These two modes go through
+// PartialUpdateObject, they are checked against the current size of the
+// object and only applied if the object has not changed meanwhile.
+func (c *Client) UpdateObjectRange(ctx context.Context, bucketName, objectName string, updateMod string, updateOffset int,
+	updateLength int64, reader io.Reader, objectSize int64) (UploadInfo, error) {
+	updateInfo := PartialUpdateInfo{
+		UpdateMode:   updateMod,
+		UpdateOffset: strconv.Itoa(updateOffset),
+	}
+	if updateLength != 0 {
+		updateInfo.UpdateLength = strconv.FormatInt(updateLength, 10)
+	}
+	if _, _, err := updateInfo.parse(); err != nil {
+		return UploadInfo{}, err
 	}
-	if updateOffset < -1 {
-		return UploadInfo{}, errors.New("offset must be greater than -1")
+	if updateMod == PartialUpdateDeleteMode || updateMod == PartialUpdateTruncateMode {
+		return c.PartialUpdateObject(ctx, bucketName, objectName, updateInfo, reader, objectSize)
 	}
 	if objectSize >= maxPartSize {
 		return UploadInfo{}, errors.New("update file is too large")
@@ -360,10 +423,6 @@ func (c *Client) UpdateObject(ctx context.Context, bucketName, objectName string
 		return UploadInfo{}, errors.New("update file is too small, Update can't use steaming upload")
 	}
 
-	updateInfo := PartialUpdateInfo{
-		UpdateMode:   updateMod,
-		UpdateOffset: strconv.Itoa(updateOffset),
-	}
 	opts := PutObjectOptions{
 		PartialUpdateInfo: updateInfo,
 		DisableMultipart:  true,
@@ -381,10 +440,18 @@ func (c *Client) AppendObject(ctx context.Context, bucketName, objectName string
 		return UploadInfo{}, errors.New("update file is too small, Update can't use steaming upload")
 	}
 
-	opts := PutObjectOptions{
-		AppendMode:       true,
-		DisableMultipart: true,
-		PartSize:         maxPartSize,
+	return c.appendObject(ctx, bucketName, objectName, reader, objectSize, PutObjectOptions{})
+}
+
+// appendObject appends with the encryption and preconditions of opts, only
+// the SSE-C key is used since the object keeps its existing encryption.
+func (c *Client) appendObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts PutObjectOptions) (UploadInfo, error) {
+	opts = PutObjectOptions{
+		ServerSideEncryption: encrypt.SSE(opts.ServerSideEncryption),
+		AppendMode:           true,
+		DisableMultipart:     true,
+		PartSize:             maxPartSize,
+		customHeaders:        opts.customHeaders,
 	}
 
 	return c.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
@@ -486,12 +553,13 @@ func (c *Client) putObjectMultipartStreamNoLength(ctx context.Context, bucketNam
 	if err != nil {
 		return UploadInfo{}, err
 	}
+	autoChecksum := opts.checksumType()
 
 	if !opts.SendContentMd5 {
 		if opts.UserMetadata == nil {
 			opts.UserMetadata = make(map[string]string, 1)
 		}
-		opts.UserMetadata["X-Amz-Checksum-Algorithm"] = "CRC32C"
+		opts.UserMetadata["X-Amz-Checksum-Algorithm"] = autoChecksum.String()
 	}
 
 	// Initiate a new multipart upload.
@@ -520,7 +588,7 @@ func (c *Client) putObjectMultipartStreamNoLength(ctx context.Context, bucketNam
 	// CRC32C is ~50% faster on AMD64 @ 30GB/s
 	var crcBytes []byte
 	customHeader := make(http.Header)
-	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	crc := autoChecksum.Hasher()
 
 	for partNumber <= totalPartsCount {
 		length, rerr := readFull(reader, buf)
@@ -543,7 +611,7 @@ func (c *Client) putObjectMultipartStreamNoLength(ctx context.Context, bucketNam
 			crc.Reset()
 			crc.Write(buf[:length])
 			cSum := crc.Sum(nil)
-			customHeader.Set("x-amz-checksum-crc32c", base64.StdEncoding.EncodeToString(cSum))
+			customHeader.Set(autoChecksum.Key(), base64.StdEncoding.EncodeToString(cSum))
 			crcBytes = append(crcBytes, cSum...)
 		}
 
@@ -599,7 +667,7 @@ func (c *Client) putObjectMultipartStreamNoLength(ctx context.Context, bucketNam
 		// Add hash of hashes.
 		crc.Reset()
 		crc.Write(crcBytes)
-		opts.UserMetadata = map[string]string{"X-Amz-Checksum-Crc32c": base64.StdEncoding.EncodeToString(crc.Sum(nil))}
+		opts.UserMetadata = map[string]string{autoChecksum.KeyCapitalized(): base64.StdEncoding.EncodeToString(crc.Sum(nil))}
 	}
 	uploadInfo, err := c.completeMultipartUpload(ctx, bucketName, objectName, uploadID, complMultipartUpload, opts)
 	if err != nil {
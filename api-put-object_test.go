@@ -25,9 +25,13 @@ import (
 	"github.com/trinet2005/oss-go-sdk/pkg/credentials"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/trinet2005/oss-go-sdk/pkg/encrypt"
 )
@@ -72,6 +76,16 @@ func TestPutObjectOptionsValidate(t *testing.T) {
 			t.Errorf("Test %d - output did not match with reference results, %s", i+1, err)
 		}
 	}
+
+	// 未知的校验类型没有对应的hash
+	if err := (PutObjectOptions{AutoChecksum: ChecksumSHA256}).validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, checksum := range []ChecksumType{checksumLast, ChecksumCRC32 | ChecksumSHA1} {
+		if err := (PutObjectOptions{AutoChecksum: checksum}).validate(); err == nil {
+			t.Fatal("expected an unsupported checksum", checksum)
+		}
+	}
 }
 
 type InterceptRouteTripper struct {
@@ -522,3 +536,465 @@ func TestSubDir(t *testing.T) {
 }
 
 /* trinet */
+
+// partialUpdateServer 模拟支持追加和局部更新的单个对象
+type partialUpdateServer struct {
+	mu   sync.Mutex
+	data []byte
+	etag int
+	puts int
+}
+
+func newPartialUpdateServer(data string) (*partialUpdateServer, *httptest.Server) {
+	s := &partialUpdateServer{data: []byte(data)}
+	return s, httptest.NewServer(s)
+}
+
+func (s *partialUpdateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		if s.data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf("\"etag%d\"", s.etag))
+		http.ServeContent(w, r, "", time.Unix(1700000000, 0), bytes.NewReader(s.data))
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAWSChunked(body)
+		}
+		etag := fmt.Sprintf("\"etag%d\"", s.etag)
+		if m := r.Header.Get("If-Match"); m != "" && (s.data == nil || m != etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && s.data != nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		s.puts++
+		mode := r.Header.Get(MinIOPartialUpdateMode)
+		offset, _ := strconv.Atoi(r.Header.Get(MinIOPartialUpdateOffset))
+		if offset == -1 {
+			offset = len(s.data)
+		}
+		switch {
+		case mode == "":
+			s.data = body
+		case offset > len(s.data):
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		case mode == PartialUpdateInsertMode:
+			s.data = append(s.data[:offset:offset], append(body, s.data[offset:]...)...)
+		case mode == PartialUpdateReplaceMode:
+			if end := offset + len(body); end > len(s.data) {
+				s.data = append(s.data, make([]byte, end-len(s.data))...)
+			}
+			copy(s.data[offset:], body)
+		case mode == PartialUpdateDeleteMode:
+			length, _ := strconv.Atoi(r.Header.Get(MinIOPartialUpdateLength))
+			if offset+length > len(s.data) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.data = append(s.data[:offset:offset], append(body, s.data[offset+length:]...)...)
+		case mode == PartialUpdateTruncateMode:
+			s.data = append(s.data[:offset:offset], body...)
+		}
+		s.etag++
+		w.Header().Set("ETag", fmt.Sprintf("\"etag%d\"", s.etag))
+	}
+}
+
+// decodeAWSChunked 去掉流式签名的分块格式
+func decodeAWSChunked(body []byte) []byte {
+	var data []byte
+	for len(body) > 0 {
+		line := body[:bytes.Index(body, []byte("\r\n"))]
+		body = body[len(line)+2:]
+		size, _ := strconv.ParseInt(string(bytes.SplitN(line, []byte(";"), 2)[0]), 16, 64)
+		if size == 0 {
+			break
+		}
+		data = append(data, body[:size]...)
+		body = body[size+2:]
+	}
+	return data
+}
+
+type countingReader struct{ n int }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.n += len(p)
+	return len(p), nil
+}
+
+// 测试分块追加和分块局部更新
+func TestAppendObjectChunked(t *testing.T) {
+	s, srv := newPartialUpdateServer("12345")
+	defer srv.Close()
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知长度的追加按4字节分块
+	progress := &countingReader{}
+	info, err := c.AppendObjectChunked(context.Background(), "bucket", "object", io.LimitReader(strings.NewReader("abcdefghij"), 10), -1,
+		ChunkedUploadOptions{ChunkSize: 4, Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s.data) != "12345abcdefghij" || s.puts != 3 || info.Size != 10 || progress.n != 10 || info.ETag != "etag3" {
+		t.Fatal("chunked append error", string(s.data), s.puts, info)
+	}
+
+	// 分块替换和插入
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateReplaceMode, 1, 0, strings.NewReader("xyzxyz"), 6,
+		ChunkedUploadOptions{ChunkSize: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateInsertMode, 2, 0, strings.NewReader("ABCDE"), 5,
+		ChunkedUploadOptions{ChunkSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.data) != "1xABCDEyzxyzcdefghij" {
+		t.Fatal("chunked update error", string(s.data))
+	}
+
+	// 分块截断或删除区间后插入其余分块，没有数据时只发送一次请求
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateTruncateMode, 7, 0, strings.NewReader("abcde"), -1,
+		ChunkedUploadOptions{ChunkSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.data) != "1xABCDEabcde" {
+		t.Fatal("chunked truncate error", string(s.data))
+	}
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateDeleteMode, 1, 6, strings.NewReader("ZZ"), 2,
+		ChunkedUploadOptions{ChunkSize: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.data) != "1ZZabcde" {
+		t.Fatal("chunked delete error", string(s.data))
+	}
+	before := s.puts
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateDeleteMode, 3, 2, nil, 0,
+		ChunkedUploadOptions{}); err != nil || string(s.data) != "1ZZcde" || s.puts != before+1 {
+		t.Fatal("chunked delete without data error", string(s.data), s.puts-before, err)
+	}
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateTruncateMode, 3, 0, strings.NewReader(""), 0,
+		ChunkedUploadOptions{}); err != nil || string(s.data) != "1ZZ" {
+		t.Fatal("chunked truncate without data error", string(s.data), err)
+	}
+	if _, err = c.UpdateObjectChunked(context.Background(), "bucket", "object", PartialUpdateDeleteMode, 2, 2, nil, 0,
+		ChunkedUploadOptions{}); ToErrorResponse(err).Code != "InvalidArgument" {
+		t.Fatal("expected a range beyond the object", err)
+	}
+
+	// 长度不足时返回已写入的大小
+	info, err = c.AppendObjectChunked(context.Background(), "bucket", "object", strings.NewReader("abc"), 8, ChunkedUploadOptions{ChunkSize: 2})
+	if err == nil || info.Size != 2 {
+		t.Fatal("expected a short payload", info.Size, err)
+	}
+
+	// 追加已生效但响应丢失时重试不重复追加
+	puts := s.puts
+	session := &chunkedSession{
+		c:          c,
+		bucketName: "bucket",
+		objectName: "object",
+		size:       int64(len(s.data)),
+		write: func(ctx context.Context, r io.Reader, n, _ int64) (UploadInfo, error) {
+			if _, err := c.appendObject(ctx, "bucket", "object", r, n, PutObjectOptions{}); err != nil {
+				return UploadInfo{}, err
+			}
+			return UploadInfo{}, errors.New("connection reset by peer")
+		},
+	}
+	if _, err = session.writeChunk(context.Background(), []byte("zz"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if s.puts != puts+1 || !strings.HasSuffix(string(s.data), "abzz") {
+		t.Fatal("retried append error", s.puts-puts, string(s.data))
+	}
+
+	// 传输层重发已生效的追加时由位置条件拒绝，不计为失败
+	session = &chunkedSession{
+		c:          c,
+		bucketName: "bucket",
+		objectName: "object",
+		size:       int64(len(s.data)),
+	}
+	session.write = func(ctx context.Context, r io.Reader, n, _ int64) (UploadInfo, error) {
+		var opts AppendObjectOptions
+		opts.SetExpectedSize(session.size)
+		if _, err := c.AppendObjectWithOptions(ctx, "bucket", "object", strings.NewReader("yy"), n, opts); err != nil {
+			return UploadInfo{}, err
+		}
+		return c.AppendObjectWithOptions(ctx, "bucket", "object", r, n, opts)
+	}
+	if _, err = session.writeChunk(context.Background(), []byte("yy"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if s.puts != puts+2 || !strings.HasSuffix(string(s.data), "abzzyy") {
+		t.Fatal("duplicate append error", s.puts-puts, string(s.data))
+	}
+}
+
+// 测试带位置条件的追加
+func TestAppendObjectWithOptions(t *testing.T) {
+	s, srv := newPartialUpdateServer("12345")
+	defer srv.Close()
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAt := func(data string, size int64, etag string) error {
+		var opts AppendObjectOptions
+		if size >= 0 {
+			if err := opts.SetExpectedSize(size); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if etag != "" {
+			if err := opts.SetMatchETag(etag); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := c.AppendObjectWithOptions(context.Background(), "bucket", "object", strings.NewReader(data), int64(len(data)), opts)
+		return err
+	}
+
+	// 大小和ETag一致时追加
+	if err = appendAt("ab", 5, "etag0"); err != nil {
+		t.Fatal(err)
+	}
+	if err = appendAt("cd", -1, "\"etag1\""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 大小不一致时不写入并返回实际大小
+	var mismatch ErrAppendPositionMismatch
+	err = appendAt("xx", 7, "")
+	if !errors.As(err, &mismatch) || mismatch.ActualSize != 9 || mismatch.ExpectedSize != 7 || mismatch.ActualETag != "etag2" {
+		t.Fatal("expected a size mismatch", err)
+	}
+	// ETag不一致时由服务端拒绝
+	err = appendAt("xx", -1, "etag1")
+	if !errors.As(err, &mismatch) || mismatch.ActualSize != 9 || mismatch.ExpectedSize != -1 {
+		t.Fatal("expected an etag mismatch", err)
+	}
+	if string(s.data) != "12345abcd" || s.puts != 2 {
+		t.Fatal("guarded append error", string(s.data), s.puts)
+	}
+
+	// 对象不存在时期望大小为0才创建
+	s.data = nil
+	if err = appendAt("xy", 1, ""); !errors.As(err, &mismatch) || mismatch.ActualSize != 0 || mismatch.ActualETag != "" {
+		t.Fatal("expected a missing object mismatch", err)
+	}
+	if err = appendAt("xy", 0, ""); err != nil || string(s.data) != "xy" {
+		t.Fatal("guarded create error", string(s.data), err)
+	}
+	if err = appendAt("xy", 0, ""); !errors.As(err, &mismatch) || mismatch.ActualSize != 2 {
+		t.Fatal("expected a mismatch on an existing object", err)
+	}
+}
+
+// 测试带缓冲的追加写入器
+func TestAppendWriter(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]*partialUpdateServer{}
+	object := func(name string) *partialUpdateServer {
+		mu.Lock()
+		defer mu.Unlock()
+		if objects[name] == nil {
+			objects[name] = &partialUpdateServer{}
+		}
+		return objects[name]
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		object(strings.TrimPrefix(r.URL.Path, "/bucket/")).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	content := func(name string) string {
+		o := object(name)
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return string(o.data)
+	}
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按大小刷新，超过对象最大大小时轮转
+	w := c.NewAppendWriter(context.Background(), "bucket", "log", AppendWriterOptions{FlushSize: 8, MaxObjectSize: 16})
+	var want string
+	for i := 0; i < 6; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		want += line
+		if _, err = fmt.Fprint(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := content("log") + content("log.1") + content("log.2")
+	if got != want || len(content("log")) > 16 || len(content("log.1")) > 16 || w.ObjectName() != "log.2" {
+		t.Fatalf("rotated append error %q %q %q", content("log"), content("log.1"), content("log.2"))
+	}
+
+	// 按时间间隔刷新
+	w = c.NewAppendWriter(context.Background(), "bucket", "tick", AppendWriterOptions{FlushInterval: 10 * time.Millisecond})
+	defer w.Close()
+	if _, err = w.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; content("tick") != "abc"; i++ {
+		if i == 100 {
+			t.Fatal("interval flush error", content("tick"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 后台刷新失败后在下一次写入时返回错误
+	o := object("tick")
+	o.mu.Lock()
+	o.data = append(o.data, "zz"...)
+	o.etag++
+	o.mu.Unlock()
+	if _, err = w.Write([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch ErrAppendPositionMismatch
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("expected a background flush error")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if _, err = w.Write([]byte("e")); err != nil {
+			break
+		}
+	}
+	if !errors.As(err, &mismatch) || mismatch.ActualSize != 5 || !errors.As(w.Close(), &mismatch) {
+		t.Fatal("expected a position mismatch", err)
+	}
+	if content("tick") != "abczz" {
+		t.Fatal("append after mismatch", content("tick"))
+	}
+}
+
+// 测试删除区间和截断的局部更新
+func TestPartialUpdateObject(t *testing.T) {
+	s, srv := newPartialUpdateServer("0123456789")
+	defer srv.Close()
+	c, err := New(srv.Listener.Addr().String(), &Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	update := func(mode, offset, length, data string) error {
+		info := PartialUpdateInfo{UpdateMode: mode, UpdateOffset: offset, UpdateLength: length}
+		_, err := c.PartialUpdateObject(ctx, "bucket", "object", info, strings.NewReader(data), int64(len(data)))
+		return err
+	}
+
+	// 删除区间和截断
+	if _, err = c.DeleteObjectRange(ctx, "bucket", "object", 2, 3); err != nil || string(s.data) != "0156789" {
+		t.Fatal("delete range error", string(s.data), err)
+	}
+	if _, err = c.TruncateObject(ctx, "bucket", "object", 4); err != nil || string(s.data) != "0156" {
+		t.Fatal("truncate error", string(s.data), err)
+	}
+
+	// 与插入组合：替换为不同长度的数据、替换对象的末尾
+	if err = update(PartialUpdateDeleteMode, "1", "2", "abc"); err != nil || string(s.data) != "0abc6" {
+		t.Fatal("delete and insert error", string(s.data), err)
+	}
+	if err = update(PartialUpdateTruncateMode, "3", "", "XY"); err != nil || string(s.data) != "0abXY" {
+		t.Fatal("truncate and append error", string(s.data), err)
+	}
+	if err = update(PartialUpdateInsertMode, "5", "", "!"); err != nil || string(s.data) != "0abXY!" {
+		t.Fatal("insert error", string(s.data), err)
+	}
+
+	// 偏移量和长度超出对象大小时不发送请求
+	puts := s.puts
+	testCases := []struct {
+		mode, offset, length string
+	}{
+		{PartialUpdateDeleteMode, "4", "3"},
+		{PartialUpdateDeleteMode, "6", "1"},
+		{PartialUpdateDeleteMode, "1", "0"},
+		{PartialUpdateDeleteMode, "-1", "1"},
+		{PartialUpdateTruncateMode, "7", ""},
+		{PartialUpdateReplaceMode, "7", ""},
+		{PartialUpdateInsertMode, "1", "2"},
+		{"Move", "1", ""},
+	}
+	for i, testCase := range testCases {
+		err = update(testCase.mode, testCase.offset, testCase.length, "")
+		if ToErrorResponse(err).Code != "InvalidArgument" {
+			t.Fatalf("Test %d: expected an invalid argument, got %v", i+1, err)
+		}
+	}
+	if s.puts != puts || string(s.data) != "0abXY!" {
+		t.Fatal("invalid update was sent", s.puts-puts, string(s.data))
+	}
+
+	// UpdateObjectRange删除区间，UpdateObject截断，按对象当前大小检查
+	if _, err = c.UpdateObjectRange(ctx, "bucket", "object", PartialUpdateDeleteMode, 1, 2, nil, 0); err != nil || string(s.data) != "0XY!" {
+		t.Fatal("update delete error", string(s.data), err)
+	}
+	if _, err = c.UpdateObject(ctx, "bucket", "object", PartialUpdateTruncateMode, 2, strings.NewReader("ab"), 2); err != nil || string(s.data) != "0Xab" {
+		t.Fatal("update truncate error", string(s.data), err)
+	}
+	if _, err = c.UpdateObject(ctx, "bucket", "object", PartialUpdateDeleteMode, 1, nil, 0); ToErrorResponse(err).Code != "InvalidArgument" {
+		t.Fatal("expected a missing length", err)
+	}
+	puts = s.puts
+	if _, err = c.UpdateObjectRange(ctx, "bucket", "object", PartialUpdateDeleteMode, 3, 2, nil, 0); ToErrorResponse(err).Code != "InvalidArgument" {
+		t.Fatal("expected a range beyond the object", err)
+	}
+	if _, err = c.UpdateObjectRange(ctx, "bucket", "object", PartialUpdateTruncateMode, 5, 0, nil, 0); ToErrorResponse(err).Code != "InvalidArgument" {
+		t.Fatal("expected an offset beyond the object", err)
+	}
+	if s.puts != puts || string(s.data) != "0Xab" {
+		t.Fatal("unchecked update was sent", s.puts-puts, string(s.data))
+	}
+
+	// 截断删除与写入的长度相同时无法从大小判断失败的请求是否生效
+	session := &chunkedSession{
+		c:          c,
+		bucketName: "bucket",
+		objectName: "object",
+		size:       4,
+		shrink:     2,
+		write: func(ctx context.Context, r io.Reader, n, _ int64) (UploadInfo, error) {
+			return UploadInfo{}, errors.New("connection reset by peer")
+		},
+	}
+	if _, err = session.writeChunk(ctx, []byte("cd"), 0); err == nil || !strings.Contains(err.Error(), "may have been applied") {
+		t.Fatal("expected an ambiguous write", err)
+	}
+
+	// 没有偏移量的局部更新与Header一样被忽略
+	if err = (PutObjectOptions{PartialUpdateInfo: PartialUpdateInfo{UpdateMode: PartialUpdateInsertMode}, DisableMultipart: true}).validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// PutObjectOptions同样检查局部更新参数
+	_, err = c.PutObject(ctx, "bucket", "object", strings.NewReader("x"), 1, PutObjectOptions{
+		PartialUpdateInfo: PartialUpdateInfo{UpdateMode: PartialUpdateTruncateMode, UpdateOffset: "1", UpdateLength: "1"},
+		DisableMultipart:  true,
+	})
+	if ToErrorResponse(err).Code != "InvalidArgument" {
+		t.Fatal("expected an invalid argument", err)
+	}
+}
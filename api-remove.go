@@ -176,8 +176,24 @@ type RemoveObjectOptions struct {
 	GovernanceBypass bool
 	VersionID        string
 	Internal         AdvancedRemoveOptions
+	/* trinet */
+	matchETag string
+	/* trinet */
 }
 
+/* trinet */
+
+// SetMatchETag removes the object only if it still has the given ETag.
+func (o *RemoveObjectOptions) SetMatchETag(etag string) error {
+	if etag == "" {
+		return errInvalidArgument("ETag cannot be empty.")
+	}
+	o.matchETag = trimEtag(etag)
+	return nil
+}
+
+/* trinet */
+
 // RemoveObject removes an object from a bucket.
 func (c *Client) RemoveObject(ctx context.Context, bucketName, objectName string, opts RemoveObjectOptions) error {
 	// Input validation.
@@ -228,6 +244,9 @@ func (c *Client) removeObject(ctx context.Context, bucketName, objectName string
 	}
 	/* trinet */
 	headers.Set(MinIODelPrefixParallelDrives, fmt.Sprintf("%d", opts.Internal.DeletePrefixParallelDrives))
+	if opts.matchETag != "" {
+		headers.Set("If-Match", "\""+opts.matchETag+"\"")
+	}
 	/* trinet */
 	// Execute DELETE on objectName.
 	resp, err := c.executeMethod(ctx, http.MethodDelete, requestMetadata{
@@ -23,7 +23,6 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"math/rand"
 	"net"
@@ -98,6 +97,17 @@ type Client struct {
 	healthStatus int32
 
 	trailingHeaderSupport bool
+
+	/* trinet */
+	// Automatic merge pack compaction, holds a *MergeCompactionPolicy, see
+	// SetMergeCompactionPolicy.
+	mergeCompaction atomic.Value
+	// Attempts of an optimistic merge index update, accessed atomically,
+	// see SetMergeIndexMaxAttempts.
+	mergeIndexAttempts int32
+	// Cache of merge indexes, holds a *mergeIndexCache, see EnableMergeIndexCache.
+	mergeIndexCache atomic.Value
+	/* trinet */
 }
 
 // Options for New method
@@ -456,8 +466,8 @@ type requestMetadata struct {
 	contentMD5Base64 string // carries base64 encoded md5sum
 	contentSHA256Hex string // carries hex encoded sha256sum
 	streamSha256     bool
-	addCrc           bool
-	trailer          http.Header // (http.Request).Trailer. Requires v4 signature.
+	addCrc           ChecksumType // trinet: checksum sent as trailer, none if not set
+	trailer          http.Header  // (http.Request).Trailer. Requires v4 signature.
 }
 
 // dumpHTTP - dump HTTP request and response.
@@ -620,16 +630,16 @@ func (c *Client) executeMethod(ctx context.Context, method string, metadata requ
 			}
 		}
 
-		if metadata.addCrc {
+		if metadata.addCrc.IsSet() {
 			if metadata.trailer == nil {
 				metadata.trailer = make(http.Header, 1)
 			}
-			crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+			crc := metadata.addCrc.Hasher()
 			metadata.contentBody = newHashReaderWrapper(metadata.contentBody, crc, func(hash []byte) {
 				// Update trailer when done.
-				metadata.trailer.Set("x-amz-checksum-crc32c", base64.StdEncoding.EncodeToString(hash))
+				metadata.trailer.Set(metadata.addCrc.Key(), base64.StdEncoding.EncodeToString(hash))
 			})
-			metadata.trailer.Set("x-amz-checksum-crc32c", base64.StdEncoding.EncodeToString(crc.Sum(nil)))
+			metadata.trailer.Set(metadata.addCrc.Key(), base64.StdEncoding.EncodeToString(crc.Sum(nil)))
 		}
 		// Instantiate a new request.
 		var req *http.Request
@@ -25,6 +25,7 @@ import (
 	"hash/crc32"
 	"io"
 	"math/bits"
+	"net/http"
 )
 
 // ChecksumType contains information about the checksum type.
@@ -78,6 +79,15 @@ func (c ChecksumType) Key() string {
 	return ""
 }
 
+/* trinet */
+
+// KeyCapitalized returns the header key as sent in user metadata.
+func (c ChecksumType) KeyCapitalized() string {
+	return http.CanonicalHeaderKey(c.Key())
+}
+
+/* trinet */
+
 // RawByteLen returns the size of the un-encoded checksum.
 func (c ChecksumType) RawByteLen() int {
 	switch c & checksumMask {
@@ -208,3 +218,50 @@ func (c Checksum) Raw() []byte {
 	}
 	return c.r
 }
+
+/* trinet */
+
+// Checksum returns the base64 checksum of type t of the part.
+func (p ObjectPart) Checksum(t ChecksumType) string {
+	return CompletePart{
+		ChecksumCRC32:  p.ChecksumCRC32,
+		ChecksumCRC32C: p.ChecksumCRC32C,
+		ChecksumSHA1:   p.ChecksumSHA1,
+		ChecksumSHA256: p.ChecksumSHA256,
+	}.Checksum(t)
+}
+
+// Checksum returns the base64 checksum of type t of the part.
+func (p CompletePart) Checksum(t ChecksumType) string {
+	switch t & checksumMask {
+	case ChecksumCRC32:
+		return p.ChecksumCRC32
+	case ChecksumCRC32C:
+		return p.ChecksumCRC32C
+	case ChecksumSHA1:
+		return p.ChecksumSHA1
+	case ChecksumSHA256:
+		return p.ChecksumSHA256
+	}
+	return ""
+}
+
+// setChecksums fills the checksums the server did not return from the
+// values sent in metadata, the hash of hashes of a multipart upload.
+func (u *UploadInfo) setChecksums(metadata map[string]string) {
+	for _, c := range []struct {
+		t ChecksumType
+		v *string
+	}{
+		{ChecksumCRC32, &u.ChecksumCRC32},
+		{ChecksumCRC32C, &u.ChecksumCRC32C},
+		{ChecksumSHA1, &u.ChecksumSHA1},
+		{ChecksumSHA256, &u.ChecksumSHA256},
+	} {
+		if *c.v == "" {
+			*c.v = metadata[c.t.KeyCapitalized()]
+		}
+	}
+}
+
+/* trinet */
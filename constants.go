@@ -110,6 +110,7 @@ const (
 	/* trinet */
 	MinIOPartialUpdateMode       = "X-Minio-Partial-Update-Mode"
 	MinIOPartialUpdateOffset     = "X-Minio-Partial-Update-Offset"
+	MinIOPartialUpdateLength     = "X-Minio-Partial-Update-Length"
 	AmzSnowballExtract           = "X-Amz-Meta-Snowball-Auto-Extract"
 	MinIOSnowballIgnoreDirs      = "X-Amz-Meta-Minio-Snowball-Ignore-Dirs"
 	MinIOMergeMultipart          = "X-Minio-Merge-Multipart"
@@ -0,0 +1,439 @@
+package ossClient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MergeIndexFormat is the encoding of the index object of a merge pack.
+type MergeIndexFormat string
+
+const (
+	// MergeIndexJSON - the whole index is one JSON document, the default.
+	MergeIndexJSON MergeIndexFormat = ""
+	// MergeIndexBinary - entries sorted by name in blocks of fixed-width
+	// records, a fence of the first name of every block and a footer at the
+	// end. One entry is found with two ranged GETs, see GetObjectIndexEntry.
+	MergeIndexBinary MergeIndexFormat = "binary"
+)
+
+// Binary index layout, all integers little endian:
+//
+//	header  "MIDX" version(uint32)
+//	blocks  per block: count records of binaryIndexRecordSize bytes
+//	        (offset int64, size int64, nameLen uint32, extraLen uint32,
+//	        flags uint32, reserved uint32) followed by name and extra JSON
+//	        of every record
+//	meta    JSON of the index without entries
+//	fence   per block: blockOff uint64, blockLen uint32, count uint32,
+//	        nameLen uint32, first name of the block
+//	footer  metaLen uint32, fenceLen uint32, blockCount uint32, "MIDX"
+const (
+	binaryIndexVersion       = 1
+	binaryIndexHeaderSize    = 8
+	binaryIndexRecordSize    = 32
+	binaryIndexFooterSize    = 16
+	binaryIndexBlockEntries  = 256
+	binaryIndexTailReadAhead = 1024 * 64
+
+	binaryIndexFlagValid = 1
+)
+
+var binaryIndexMagic = []byte("MIDX")
+
+var errInvalidBinaryIndex = errors.New("invalid binary merge index")
+
+// objectIndexExtra holds the optional fields of an entry stored as JSON
+// next to its fixed-width record.
+type objectIndexExtra struct {
+	ContentType  string            `json:"contentType,omitempty"`
+	ModTime      int64             `json:"modTime,omitempty"`
+	UserMetadata map[string]string `json:"userMetadata,omitempty"`
+	ChecksumType ChecksumType      `json:"checksumType,omitempty"`
+	Checksum     string            `json:"checksum,omitempty"`
+}
+
+// isBinaryIndex reports whether buf starts like a binary index.
+func isBinaryIndex(buf []byte) bool {
+	return bytes.HasPrefix(buf, binaryIndexMagic)
+}
+
+// MarshalBinary encodes the index in the MergeIndexBinary format.
+func (m *ObjectIndexInfo) MarshalBinary() ([]byte, error) {
+	names := make([]string, 0, len(m.Info))
+	for name := range m.Info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf, fence bytes.Buffer
+	le := binary.LittleEndian
+	buf.Write(binaryIndexMagic)
+	binary.Write(&buf, le, uint32(binaryIndexVersion))
+
+	blockCount := 0
+	for start := 0; start < len(names); start += binaryIndexBlockEntries {
+		end := start + binaryIndexBlockEntries
+		if end > len(names) {
+			end = len(names)
+		}
+		block := names[start:end]
+		blockOff := buf.Len()
+
+		extras := make([][]byte, len(block))
+		for i, name := range block {
+			idx := m.Info[name]
+			extra := objectIndexExtra{
+				ContentType:  idx.ContentType,
+				ModTime:      idx.ModTime,
+				UserMetadata: idx.UserMetadata,
+				ChecksumType: idx.ChecksumType,
+				Checksum:     idx.Checksum,
+			}
+			if extra.ContentType != "" || extra.ModTime != 0 || len(extra.UserMetadata) > 0 || extra.Checksum != "" {
+				b, err := json.Marshal(extra)
+				if err != nil {
+					return nil, err
+				}
+				extras[i] = b
+			}
+
+			var flags uint32
+			if idx.Valid {
+				flags |= binaryIndexFlagValid
+			}
+			binary.Write(&buf, le, idx.Offset)
+			binary.Write(&buf, le, idx.Size)
+			binary.Write(&buf, le, uint32(len(name)))
+			binary.Write(&buf, le, uint32(len(extras[i])))
+			binary.Write(&buf, le, flags)
+			binary.Write(&buf, le, uint32(0))
+		}
+		for i, name := range block {
+			buf.WriteString(name)
+			buf.Write(extras[i])
+		}
+
+		binary.Write(&fence, le, uint64(blockOff))
+		binary.Write(&fence, le, uint32(buf.Len()-blockOff))
+		binary.Write(&fence, le, uint32(len(block)))
+		binary.Write(&fence, le, uint32(len(block[0])))
+		fence.WriteString(block[0])
+		blockCount++
+	}
+
+	header := *m
+	header.Info = nil
+	meta, err := json.Marshal(&header)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(meta)
+	buf.Write(fence.Bytes())
+
+	binary.Write(&buf, le, uint32(len(meta)))
+	binary.Write(&buf, le, uint32(fence.Len()))
+	binary.Write(&buf, le, uint32(blockCount))
+	buf.Write(binaryIndexMagic)
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes an index in the MergeIndexBinary format.
+func (m *ObjectIndexInfo) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryIndexHeaderSize+binaryIndexFooterSize || !isBinaryIndex(data) {
+		return errInvalidBinaryIndex
+	}
+	tail, err := parseBinaryIndexTail(data, int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	info := make(map[string]*ObjectIndex)
+	for _, block := range tail.fence {
+		err := decodeBinaryIndexBlock(data[block.off:block.off+block.length], block.count, func(name string, idx *ObjectIndex) bool {
+			info[name] = idx
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	*m = *tail.meta
+	m.Info = info
+	m.Format = MergeIndexBinary
+	return nil
+}
+
+// binaryIndexFence - location of one block of a binary index.
+type binaryIndexFence struct {
+	off, length int64
+	count       int
+	firstName   string
+}
+
+// binaryIndexTail - decoded meta and fence of a binary index.
+type binaryIndexTail struct {
+	meta  *ObjectIndexInfo
+	fence []binaryIndexFence
+}
+
+// binaryIndexTailSize returns how many bytes at the end of the index are
+// needed for parseBinaryIndexTail, buf holds at least the footer.
+func binaryIndexTailSize(buf []byte) (int64, error) {
+	if len(buf) < binaryIndexFooterSize || !bytes.Equal(buf[len(buf)-4:], binaryIndexMagic) {
+		return 0, errInvalidBinaryIndex
+	}
+	footer := buf[len(buf)-binaryIndexFooterSize:]
+	le := binary.LittleEndian
+	return int64(le.Uint32(footer[0:])) + int64(le.Uint32(footer[4:])) + binaryIndexFooterSize, nil
+}
+
+// parseBinaryIndexTail decodes the meta and fence from the end of buf, the
+// last bytes of an index of indexSize bytes. Blocks must lie between the
+// header and the tail.
+func parseBinaryIndexTail(buf []byte, indexSize int64) (*binaryIndexTail, error) {
+	tailSize, err := binaryIndexTailSize(buf)
+	if err != nil {
+		return nil, err
+	}
+	if tailSize > int64(len(buf)) || tailSize > indexSize-binaryIndexHeaderSize {
+		return nil, errInvalidBinaryIndex
+	}
+	blocksEnd := indexSize - tailSize
+
+	le := binary.LittleEndian
+	footer := buf[len(buf)-binaryIndexFooterSize:]
+	metaLen := int(le.Uint32(footer[0:]))
+	blockCount := int(le.Uint32(footer[8:]))
+
+	tail := buf[int64(len(buf))-tailSize:]
+	meta := &ObjectIndexInfo{}
+	if err = json.Unmarshal(tail[:metaLen], meta); err != nil {
+		return nil, err
+	}
+
+	fence := tail[metaLen : len(tail)-binaryIndexFooterSize]
+	blocks := make([]binaryIndexFence, 0, blockCount)
+	for i := 0; i < blockCount; i++ {
+		if len(fence) < 20 {
+			return nil, errInvalidBinaryIndex
+		}
+		nameLen := int(le.Uint32(fence[16:]))
+		if len(fence) < 20+nameLen {
+			return nil, errInvalidBinaryIndex
+		}
+		block := binaryIndexFence{
+			off:       int64(le.Uint64(fence[0:])),
+			length:    int64(le.Uint32(fence[8:])),
+			count:     int(le.Uint32(fence[12:])),
+			firstName: string(fence[20 : 20+nameLen]),
+		}
+		if block.off < binaryIndexHeaderSize || block.off > blocksEnd || block.length > blocksEnd-block.off {
+			return nil, errInvalidBinaryIndex
+		}
+		blocks = append(blocks, block)
+		fence = fence[20+nameLen:]
+	}
+
+	return &binaryIndexTail{meta: meta, fence: blocks}, nil
+}
+
+// decodeBinaryIndexBlock calls fn for every entry of a block until fn
+// returns false.
+func decodeBinaryIndexBlock(block []byte, count int, fn func(name string, idx *ObjectIndex) bool) error {
+	le := binary.LittleEndian
+	if len(block) < count*binaryIndexRecordSize {
+		return errInvalidBinaryIndex
+	}
+	pos := count * binaryIndexRecordSize
+	for i := 0; i < count; i++ {
+		record := block[i*binaryIndexRecordSize:]
+		nameLen := int(le.Uint32(record[16:]))
+		extraLen := int(le.Uint32(record[20:]))
+		if len(block) < pos+nameLen+extraLen {
+			return errInvalidBinaryIndex
+		}
+
+		idx := &ObjectIndex{
+			Valid:  le.Uint32(record[24:])&binaryIndexFlagValid != 0,
+			Offset: int64(le.Uint64(record[0:])),
+			Size:   int64(le.Uint64(record[8:])),
+		}
+		name := string(block[pos : pos+nameLen])
+		pos += nameLen
+		if extraLen > 0 {
+			var extra objectIndexExtra
+			if err := json.Unmarshal(block[pos:pos+extraLen], &extra); err != nil {
+				return err
+			}
+			idx.ContentType = extra.ContentType
+			idx.ModTime = extra.ModTime
+			idx.UserMetadata = extra.UserMetadata
+			idx.ChecksumType = extra.ChecksumType
+			idx.Checksum = extra.Checksum
+			pos += extraLen
+		}
+
+		if !fn(name, idx) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// encodeObjectIndexInfo encodes the index in its format.
+func encodeObjectIndexInfo(meta *ObjectIndexInfo) ([]byte, error) {
+	if meta.Format == MergeIndexBinary {
+		return meta.MarshalBinary()
+	}
+	return json.Marshal(meta)
+}
+
+// decodeObjectIndexInfo detects the format of buf and decodes it.
+func decodeObjectIndexInfo(buf []byte, meta *ObjectIndexInfo) error {
+	if isBinaryIndex(buf) {
+		return meta.UnmarshalBinary(buf)
+	}
+	return json.Unmarshal(buf, meta)
+}
+
+// GetObjectIndexEntry returns an index holding only the entry objectName,
+// it can be passed to GetObjectWithIndex. For a binary index only the tail
+// and the block of the entry are downloaded, pinned to the ETag of the
+// first read; an index replaced in between and a JSON index are
+// downloaded as a whole.
+func (c *Client) GetObjectIndexEntry(ctx context.Context, id, bucketName, objectName string) (*ObjectIndexInfo, error) {
+	meta, err := c.getObjectIndexEntry(ctx, id, bucketName, objectName)
+	if err != errNotBinaryIndex && !isPreconditionFailed(err) {
+		return meta, err
+	}
+
+	meta, err = c.GetObjectIndexInfo(ctx, id, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return singleEntryIndex(meta, objectName, meta.Info[objectName])
+}
+
+// errNotBinaryIndex - the index is not in the MergeIndexBinary format.
+var errNotBinaryIndex = errors.New("not a binary merge index")
+
+// getObjectIndexEntry reads the entry from a binary index with ranged GETs
+// of one generation of the index object.
+func (c *Client) getObjectIndexEntry(ctx context.Context, id, bucketName, objectName string) (*ObjectIndexInfo, error) {
+	opts := GetObjectOptions{}
+	if err := opts.SetRange(0, -binaryIndexTailReadAhead); err != nil {
+		return nil, err
+	}
+	buf, indexSize, etag, err := c.getObjectIndexRange(ctx, id, bucketName, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Small indexes are returned whole, sniff the JSON ones.
+	if !bytes.HasSuffix(buf, binaryIndexMagic) {
+		return nil, errNotBinaryIndex
+	}
+
+	tailSize, err := binaryIndexTailSize(buf)
+	if err != nil {
+		return nil, err
+	}
+	if tailSize > int64(len(buf)) {
+		opts = GetObjectOptions{}
+		if err = opts.SetRange(0, -tailSize); err != nil {
+			return nil, err
+		}
+		if etag != "" {
+			opts.SetMatchETag(etag)
+		}
+		if buf, _, _, err = c.getObjectIndexRange(ctx, id, bucketName, opts); err != nil {
+			return nil, err
+		}
+	}
+	tail, err := parseBinaryIndexTail(buf, indexSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Last block whose first name is not after objectName.
+	i := sort.Search(len(tail.fence), func(i int) bool {
+		return tail.fence[i].firstName > objectName
+	}) - 1
+	if i < 0 {
+		return nil, errors.New("object not found")
+	}
+	block := tail.fence[i]
+
+	opts = GetObjectOptions{}
+	if err = opts.SetRange(block.off, block.off+block.length-1); err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		opts.SetMatchETag(etag)
+	}
+	if buf, _, _, err = c.getObjectIndexRange(ctx, id, bucketName, opts); err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) != block.length {
+		return nil, errInvalidBinaryIndex
+	}
+
+	var found *ObjectIndex
+	err = decodeBinaryIndexBlock(buf, block.count, func(name string, idx *ObjectIndex) bool {
+		if name == objectName {
+			found = idx
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tail.meta.Format = MergeIndexBinary
+	return singleEntryIndex(tail.meta, objectName, found)
+}
+
+// getObjectIndexRange downloads a range of the index object and returns it
+// along with the size and the ETag of the whole index object.
+func (c *Client) getObjectIndexRange(ctx context.Context, id, bucketName string, opts GetObjectOptions) ([]byte, int64, string, error) {
+	reader, objInfo, header, err := c.getObject(ctx, bucketName, MergeDir+IdxPrefix+id, opts)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer reader.Close()
+	buf, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	// Content-Range: bytes first-last/size, missing if the whole object
+	// was returned.
+	size := int64(len(buf))
+	if cr := header.Get("Content-Range"); cr != "" {
+		i := strings.LastIndex(cr, "/")
+		if size, err = strconv.ParseInt(cr[i+1:], 10, 64); i < 0 || err != nil {
+			return nil, 0, "", errInvalidBinaryIndex
+		}
+	}
+	return buf, size, objInfo.ETag, nil
+}
+
+// singleEntryIndex returns a copy of the index header with one entry.
+func singleEntryIndex(meta *ObjectIndexInfo, objectName string, idx *ObjectIndex) (*ObjectIndexInfo, error) {
+	if idx == nil {
+		return nil, errors.New("object not found")
+	}
+	entry := *meta
+	entry.Info = map[string]*ObjectIndex{objectName: idx}
+	return &entry, nil
+}
@@ -0,0 +1,164 @@
+package ossClient
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MergeIndexCacheStats - counters of the merge index cache.
+type MergeIndexCacheStats struct {
+	Hits      uint64 // index revalidated with If-None-Match and served from the cache
+	Misses    uint64 // index downloaded and decoded
+	Evictions uint64 // entries dropped to honor the cache size
+	Entries   int    // entries currently cached
+}
+
+// mergeIndexCacheEntry - one cached index.
+type mergeIndexCacheEntry struct {
+	key  string
+	etag string
+	meta *ObjectIndexInfo
+}
+
+// mergeIndexCache - Bounded LRU cache of merge indexes keyed by bucket
+// and merge ID, entries are only served after revalidation of their ETag.
+type mergeIndexCache struct {
+	// mutex is used for handling the concurrent
+	// read/write requests for cache.
+	sync.Mutex
+
+	size  int
+	lru   *list.List
+	items map[string]*list.Element
+	stats MergeIndexCacheStats
+}
+
+// newMergeIndexCache - Provides a new merge index cache holding at most
+// size indexes.
+func newMergeIndexCache(size int) *mergeIndexCache {
+	return &mergeIndexCache{
+		size:  size,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func mergeIndexCacheKey(bucketName, id string) string {
+	return bucketName + "/" + id
+}
+
+// Get - Returns the cached ETag of an index, the index itself is only
+// handed out by Hit once the ETag was revalidated.
+func (r *mergeIndexCache) Get(bucketName, id string) (etag string, ok bool) {
+	r.Lock()
+	defer r.Unlock()
+	elem, ok := r.items[mergeIndexCacheKey(bucketName, id)]
+	if !ok {
+		return "", false
+	}
+	return elem.Value.(*mergeIndexCacheEntry).etag, true
+}
+
+// Hit - Returns a copy of the cached index if it still has the ETag that
+// was revalidated.
+func (r *mergeIndexCache) Hit(bucketName, id, etag string) (*ObjectIndexInfo, bool) {
+	r.Lock()
+	defer r.Unlock()
+	elem, ok := r.items[mergeIndexCacheKey(bucketName, id)]
+	if !ok || elem.Value.(*mergeIndexCacheEntry).etag != etag {
+		return nil, false
+	}
+	r.lru.MoveToFront(elem)
+	r.stats.Hits++
+	return elem.Value.(*mergeIndexCacheEntry).meta.clone(), true
+}
+
+// Set - Will persist a copy of a downloaded index into cache.
+func (r *mergeIndexCache) Set(bucketName, id, etag string, meta *ObjectIndexInfo) {
+	r.Lock()
+	defer r.Unlock()
+	r.stats.Misses++
+
+	key := mergeIndexCacheKey(bucketName, id)
+	if elem, ok := r.items[key]; ok {
+		entry := elem.Value.(*mergeIndexCacheEntry)
+		entry.etag = etag
+		entry.meta = meta.clone()
+		r.lru.MoveToFront(elem)
+		return
+	}
+
+	r.items[key] = r.lru.PushFront(&mergeIndexCacheEntry{key: key, etag: etag, meta: meta.clone()})
+	for r.lru.Len() > r.size {
+		elem := r.lru.Back()
+		r.lru.Remove(elem)
+		delete(r.items, elem.Value.(*mergeIndexCacheEntry).key)
+		r.stats.Evictions++
+	}
+}
+
+// Delete - Deletes an index from cache.
+func (r *mergeIndexCache) Delete(bucketName, id string) {
+	r.Lock()
+	defer r.Unlock()
+	key := mergeIndexCacheKey(bucketName, id)
+	if elem, ok := r.items[key]; ok {
+		r.lru.Remove(elem)
+		delete(r.items, key)
+	}
+}
+
+// Stats - Returns a snapshot of the counters.
+func (r *mergeIndexCache) Stats() MergeIndexCacheStats {
+	r.Lock()
+	defer r.Unlock()
+	stats := r.stats
+	stats.Entries = r.lru.Len()
+	return stats
+}
+
+// clone returns a deep copy of the index, cached indexes must not be
+// shared with callers that modify them.
+func (m *ObjectIndexInfo) clone() *ObjectIndexInfo {
+	n := *m
+	n.Info = make(map[string]*ObjectIndex, len(m.Info))
+	for name, idx := range m.Info {
+		entry := *idx
+		if idx.UserMetadata != nil {
+			entry.UserMetadata = make(map[string]string, len(idx.UserMetadata))
+			for k, v := range idx.UserMetadata {
+				entry.UserMetadata[k] = v
+			}
+		}
+		n.Info[name] = &entry
+	}
+	return &n
+}
+
+// EnableMergeIndexCache caches up to size merge indexes on the client,
+// a cached index is revalidated with If-None-Match on every use so only
+// a changed index is downloaded again. A size below 1 disables the cache.
+// It may be called while the client is in use, the indexes cached so far
+// are dropped.
+func (c *Client) EnableMergeIndexCache(size int) {
+	var cache *mergeIndexCache
+	if size >= 1 {
+		cache = newMergeIndexCache(size)
+	}
+	c.mergeIndexCache.Store(cache)
+}
+
+// indexCache returns the merge index cache, nil if it is disabled.
+func (c *Client) indexCache() *mergeIndexCache {
+	cache, _ := c.mergeIndexCache.Load().(*mergeIndexCache)
+	return cache
+}
+
+// MergeIndexCacheStats returns the counters of the merge index cache.
+func (c *Client) MergeIndexCacheStats() MergeIndexCacheStats {
+	cache := c.indexCache()
+	if cache == nil {
+		return MergeIndexCacheStats{}
+	}
+	return cache.Stats()
+}